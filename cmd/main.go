@@ -2,15 +2,22 @@ package main
 
 import (
 	"context"
-	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
+	"subscription-service/internal/app"
 	"subscription-service/internal/config"
 	appdb "subscription-service/internal/db"
 	apphttp "subscription-service/internal/http"
 	"subscription-service/internal/logger"
+	"subscription-service/internal/metrics"
 	"subscription-service/internal/repository"
 	"subscription-service/internal/service"
+	"subscription-service/internal/tracing"
 
 	"go.uber.org/zap"
 )
@@ -21,34 +28,82 @@ func main() {
 
 	log, err := logger.New(cfg.Log.Level)
 	if err != nil { panic(err) }
-	defer log.Sync()
+	zap.ReplaceGlobals(log)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:     cfg.Tracing.Exporter,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		SampleRatio:  cfg.Tracing.SampleRatio,
+		ServiceName:  cfg.Tracing.ServiceName,
+	})
+	if err != nil { log.Fatal("tracing", zap.Error(err)) }
 
-	ctx := context.Background()
 	db, err := appdb.Connect(ctx, cfg.Postgres.DSN, cfg.Postgres.MinConns, cfg.Postgres.MaxConns)
 	if err != nil { log.Fatal("db connect", zap.Error(err)) }
-	defer db.Close()
 
-	if err := appdb.RunMigrations(ctx, cfg.Postgres.DSN); err != nil { log.Fatal("migrations", zap.Error(err)) }
+	if err := appdb.RunMigrations(ctx, cfg.Postgres.DSN); err != nil { db.Close(); log.Fatal("migrations", zap.Error(err)) }
 
-	repo := repository.NewSubscriptionRepository(db.Pool)
-	svc := service.NewSubscriptionService(repo)
+	repo := repository.NewSubscriptionRepository(db.Pool, repository.Timeouts{
+		Read:      time.Duration(cfg.Postgres.ReadTimeoutMs) * time.Millisecond,
+		Write:     time.Duration(cfg.Postgres.WriteTimeoutMs) * time.Millisecond,
+		Aggregate: time.Duration(cfg.Postgres.AggregateTimeoutMs) * time.Millisecond,
+	})
+	svc := service.NewSubscriptionService(repo, service.Options{
+		IdempotencyTTL:   time.Duration(cfg.Idempotency.TTLHours) * time.Hour,
+		DeletedRetention: time.Duration(cfg.SoftDelete.RetentionDays) * 24 * time.Hour,
+	})
+	if cfg.ExchangeRates.File != "" {
+		if err := loadExchangeRates(ctx, svc, cfg.ExchangeRates.File); err != nil { db.Close(); log.Fatal("exchange rates", zap.Error(err)) }
+	}
+	go app.RunPeriodically(ctx, log, "purge idempotency keys", time.Duration(cfg.Idempotency.PurgeIntervalMinutes)*time.Minute, svc.PurgeExpiredIdempotencyKeys)
+	go app.RunPeriodically(ctx, log, "purge deleted subscriptions", time.Duration(cfg.SoftDelete.PurgeIntervalMinutes)*time.Minute, svc.PurgeDeleted)
 
-	h := apphttp.NewHandlers(log, svc)
-	srv := apphttp.NewServer(log)
-	srv.RegisterRoutes(h)
+	m := metrics.New()
+	m.RegisterPool(db.Pool)
+	go m.RunBusinessRefresh(ctx, log, time.Duration(cfg.Metrics.RefreshIntervalSeconds)*time.Second, func(ctx context.Context) ([]metrics.ServiceSpend, error) {
+		now := time.Now().UTC()
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		buckets, err := svc.MonthlySpend(ctx, month)
+		if err != nil { return nil, err }
+		items := make([]metrics.ServiceSpend, 0, len(buckets))
+		for _, b := range buckets {
+			items = append(items, metrics.ServiceSpend{ServiceName: b.Key, Currency: b.Amount.Currency, Subscriptions: b.Subscriptions, Amount: b.Amount.Float64()})
+		}
+		return items, nil
+	})
 
-	server := &http.Server{
-		Addr:         cfg.HTTP.Address,
-		Handler:      srv.Router,
-		ReadTimeout:  time.Duration(cfg.HTTP.ReadTimeoutSeconds) * time.Second,
-		WriteTimeout: time.Duration(cfg.HTTP.WriteTimeoutSeconds) * time.Second,
-		IdleTimeout:  time.Duration(cfg.HTTP.IdleTimeoutSeconds) * time.Second,
-	}
+	h := apphttp.NewHandlers(svc, apphttp.HandlerOptions{RequireIfMatch: cfg.HTTP.RequireIfMatch})
+	srv := apphttp.NewServer(log, m)
+	srv.RegisterRoutes(h)
+	srv.RegisterHealth(db)
 
-	log.Info("starting http server", zap.String("addr", cfg.HTTP.Address))
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatal("server", zap.Error(err))
+	a := app.New(log, srv, db, app.Options{
+		Address:       cfg.HTTP.Address,
+		ReadTimeout:   time.Duration(cfg.HTTP.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:  time.Duration(cfg.HTTP.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:   time.Duration(cfg.HTTP.IdleTimeoutSeconds) * time.Second,
+		ShutdownDelay: time.Duration(cfg.HTTP.ShutdownDelaySeconds) * time.Second,
+		ShutdownGrace: time.Duration(cfg.HTTP.ShutdownGraceSeconds) * time.Second,
+	})
+	runErr := a.Run(ctx)
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil { log.Error("flush traces", zap.Error(err)) }
+	if runErr != nil {
+		log.Fatal("server", zap.Error(runErr))
 	}
 }
 
-
+// loadExchangeRates loads a rates file, picking the format from its extension.
+func loadExchangeRates(ctx context.Context, svc *service.SubscriptionService, path string) error {
+	f, err := os.Open(path)
+	if err != nil { return err }
+	defer f.Close()
+	format := service.RatesFormatCSV
+	if strings.EqualFold(filepath.Ext(path), ".xml") { format = service.RatesFormatXML }
+	_, err = svc.LoadExchangeRates(ctx, f, format)
+	return err
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	appdb "subscription-service/internal/db"
+	apphttp "subscription-service/internal/http"
+
+	"go.uber.org/zap"
+)
+
+type Options struct {
+	Address       string
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	IdleTimeout   time.Duration
+	ShutdownDelay time.Duration
+	ShutdownGrace time.Duration
+}
+
+// App owns the HTTP server and the resources it depends on and tears them down in order:
+// readiness goes red, the listener closes, in-flight requests drain, then the pool and logger close.
+type App struct {
+	log    *zap.Logger
+	srv    *apphttp.Server
+	db     *appdb.Postgres
+	opts   Options
+	server *http.Server
+}
+
+func New(log *zap.Logger, srv *apphttp.Server, db *appdb.Postgres, opts Options) *App {
+	return &App{
+		log:  log,
+		srv:  srv,
+		db:   db,
+		opts: opts,
+		server: &http.Server{
+			Addr:         opts.Address,
+			Handler:      srv.Router,
+			ReadTimeout:  opts.ReadTimeout,
+			WriteTimeout: opts.WriteTimeout,
+			IdleTimeout:  opts.IdleTimeout,
+		},
+	}
+}
+
+// Run listens on the configured address and serves until ctx is canceled.
+func (a *App) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", a.opts.Address)
+	if err != nil { return fmt.Errorf("listen: %w", err) }
+	return a.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is canceled or the server fails, then shuts down gracefully.
+func (a *App) Serve(ctx context.Context, ln net.Listener) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- a.server.Serve(ln) }()
+
+	a.srv.SetReady(true)
+	a.log.Info("http server started", zap.String("addr", ln.Addr().String()))
+
+	var serveErr error
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) { serveErr = fmt.Errorf("serve: %w", err) }
+	case <-ctx.Done():
+		a.log.Info("shutdown requested")
+	}
+	return errors.Join(serveErr, a.shutdown())
+}
+
+func (a *App) shutdown() error {
+	a.srv.SetReady(false)
+	if a.opts.ShutdownDelay > 0 {
+		a.log.Info("waiting for load balancers to observe readiness", zap.Duration("delay", a.opts.ShutdownDelay))
+		time.Sleep(a.opts.ShutdownDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.ShutdownGrace)
+	defer cancel()
+	var err error
+	if shutdownErr := a.server.Shutdown(ctx); shutdownErr != nil {
+		a.log.Warn("http drain incomplete, closing remaining connections", zap.Error(shutdownErr))
+		err = errors.Join(fmt.Errorf("shutdown http: %w", shutdownErr), a.server.Close())
+	}
+
+	a.db.Close()
+	a.log.Info("shutdown complete")
+	_ = a.log.Sync()
+	return err
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	apphttp "subscription-service/internal/http"
+
+	"go.uber.org/zap"
+)
+
+// waitFor polls cond until it holds or the deadline passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) { t.Fatalf("timed out waiting for %s", what) }
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServeDrainsInFlightRequestsOnCancel(t *testing.T) {
+	srv := apphttp.NewServer(zap.NewNop(), nil)
+	started, release := make(chan struct{}), make(chan struct{})
+	srv.Router.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	})
+	a := New(zap.NewNop(), srv, nil, Options{ShutdownGrace: 5 * time.Second})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	addr := ln.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- a.Serve(ctx, ln) }()
+	waitFor(t, "readiness", srv.Ready)
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			resCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		resCh <- result{status: resp.StatusCode, body: string(b), err: err}
+	}()
+	<-started
+
+	cancel()
+	waitFor(t, "readiness to fail", func() bool { return !srv.Ready() })
+	waitFor(t, "the listener to close", func() bool {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err != nil { return true }
+		conn.Close()
+		return false
+	})
+	select {
+	case <-served:
+		t.Fatal("Serve returned while a request was still in flight")
+	default:
+	}
+
+	close(release)
+	res := <-resCh
+	if res.err != nil { t.Fatalf("in-flight request failed: %v", res.err) }
+	if res.status != http.StatusOK || res.body != "done" { t.Fatalf("in-flight request got %d %q", res.status, res.body) }
+	select {
+	case err := <-served:
+		if err != nil { t.Fatalf("Serve: %v", err) }
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after draining")
+	}
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RunPeriodically calls job every interval until ctx is done. Job reports how many rows it
+// touched, which is logged when non-zero. A non-positive interval disables the job.
+func RunPeriodically(ctx context.Context, log *zap.Logger, name string, interval time.Duration, job func(context.Context) (int64, error)) {
+	if interval <= 0 { return }
+	log = log.With(zap.String("job", name))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := job(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.Warn("periodic job failed", zap.Error(err))
+		case n > 0:
+			log.Info("periodic job done", zap.Int64("rows", n))
+		}
+	}
+}
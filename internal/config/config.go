@@ -13,14 +13,45 @@ type Config struct {
 		ReadTimeoutSeconds int `mapstructure:"read_timeout_seconds"`
 		WriteTimeoutSeconds int `mapstructure:"write_timeout_seconds"`
 		IdleTimeoutSeconds int `mapstructure:"idle_timeout_seconds"`
+		ShutdownDelaySeconds int `mapstructure:"shutdown_delay_seconds"`
+		ShutdownGraceSeconds int `mapstructure:"shutdown_grace_seconds"`
+		RequireIfMatch bool `mapstructure:"require_if_match"`
 	} `mapstructure:"http"`
 
 	Postgres struct {
 		DSN string `mapstructure:"dsn"`
 		MaxConns int32 `mapstructure:"max_conns"`
 		MinConns int32 `mapstructure:"min_conns"`
+		ReadTimeoutMs int `mapstructure:"read_timeout_ms"`
+		WriteTimeoutMs int `mapstructure:"write_timeout_ms"`
+		AggregateTimeoutMs int `mapstructure:"aggregate_timeout_ms"`
 	} `mapstructure:"postgres"`
 
+	Metrics struct {
+		RefreshIntervalSeconds int `mapstructure:"refresh_interval_seconds"`
+	} `mapstructure:"metrics"`
+
+	Tracing struct {
+		Exporter string `mapstructure:"exporter"`
+		OTLPEndpoint string `mapstructure:"otlp_endpoint"`
+		SampleRatio float64 `mapstructure:"sample_ratio"`
+		ServiceName string `mapstructure:"service_name"`
+	} `mapstructure:"tracing"`
+
+	Idempotency struct {
+		TTLHours int `mapstructure:"ttl_hours"`
+		PurgeIntervalMinutes int `mapstructure:"purge_interval_minutes"`
+	} `mapstructure:"idempotency"`
+
+	SoftDelete struct {
+		RetentionDays int `mapstructure:"retention_days"`
+		PurgeIntervalMinutes int `mapstructure:"purge_interval_minutes"`
+	} `mapstructure:"soft_delete"`
+
+	ExchangeRates struct {
+		File string `mapstructure:"file"`
+	} `mapstructure:"exchange_rates"`
+
 	Log struct {
 		Level string `mapstructure:"level"`
 	} `mapstructure:"log"`
@@ -41,8 +72,23 @@ func Load() (*Config, error) {
 	v.SetDefault("http.read_timeout_seconds", 10)
 	v.SetDefault("http.write_timeout_seconds", 10)
 	v.SetDefault("http.idle_timeout_seconds", 60)
+	v.SetDefault("http.shutdown_delay_seconds", 0)
+	v.SetDefault("http.shutdown_grace_seconds", 20)
+	v.SetDefault("http.require_if_match", false)
 	v.SetDefault("postgres.max_conns", 10)
 	v.SetDefault("postgres.min_conns", 2)
+	v.SetDefault("postgres.read_timeout_ms", 3000)
+	v.SetDefault("postgres.write_timeout_ms", 3000)
+	v.SetDefault("postgres.aggregate_timeout_ms", 8000)
+	v.SetDefault("metrics.refresh_interval_seconds", 60)
+	v.SetDefault("tracing.exporter", "none")
+	v.SetDefault("tracing.sample_ratio", 1.0)
+	v.SetDefault("tracing.service_name", "subscription-service")
+	v.SetDefault("idempotency.ttl_hours", 24)
+	v.SetDefault("idempotency.purge_interval_minutes", 60)
+	v.SetDefault("soft_delete.retention_days", 30)
+	v.SetDefault("soft_delete.purge_interval_minutes", 60)
+	v.SetDefault("exchange_rates.file", "")
 	v.SetDefault("log.level", "info")
 
 	_ = v.ReadInConfig()
@@ -9,6 +9,8 @@ import (
     "github.com/pressly/goose/v3"
 )
 
+const MigrationsDir = "./migrations"
+
 func RunMigrations(ctx context.Context, dsn string) error {
     sqldb, err := sql.Open("pgx", dsn)
     if err != nil {
@@ -21,10 +23,31 @@ func RunMigrations(ctx context.Context, dsn string) error {
     }
 
     goose.SetDialect("postgres")
-    if err := goose.UpContext(ctx, sqldb, "./migrations"); err != nil {
+    if err := goose.UpContext(ctx, sqldb, MigrationsDir); err != nil {
         return fmt.Errorf("migrations up: %w", err)
     }
     return nil
 }
 
 
+
+// MigrationVersions returns the version applied to the database and the newest version on disk.
+func (p *Postgres) MigrationVersions(ctx context.Context) (current, latest int64, err error) {
+    migrations, err := goose.CollectMigrations(MigrationsDir, 0, goose.MaxVersion)
+    if err != nil {
+        return 0, 0, fmt.Errorf("collect migrations: %w", err)
+    }
+    last, err := migrations.Last()
+    if err != nil {
+        return 0, 0, fmt.Errorf("last migration: %w", err)
+    }
+
+    // goose appends a row per up/down; the newest row of each version tells whether it is applied.
+    const q = `SELECT COALESCE(MAX(version_id), 0) FROM (
+        SELECT DISTINCT ON (version_id) version_id, is_applied FROM goose_db_version ORDER BY version_id, id DESC
+    ) v WHERE is_applied`
+    if err := p.Pool.QueryRow(ctx, q).Scan(&current); err != nil {
+        return 0, 0, fmt.Errorf("db version: %w", err)
+    }
+    return current, last.Version, nil
+}
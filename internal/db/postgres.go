@@ -22,6 +22,7 @@ func Connect(ctx context.Context, dsn string, minConns, maxConns int32) (*Postgr
 	config.HealthCheckPeriod = 30 * time.Second
 	config.MaxConnLifetime = 60 * time.Minute
 	config.MaxConnIdleTime = 15 * time.Minute
+	config.ConnConfig.Tracer = NewQueryTracer()
 
 	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
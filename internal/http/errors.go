@@ -0,0 +1,53 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/models"
+)
+
+// writeError renders err in the models.ErrorResponse envelope, picking the status from its kind.
+// Internal errors are logged and never leak their cause to the client.
+func (h *HandlersImpl) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, models.ErrBadRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, models.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, models.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, models.ErrValidation):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, models.ErrPrecondition):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, models.ErrPreconditionRequired):
+		status = http.StatusPreconditionRequired
+	case errors.Is(err, models.ErrMediaType):
+		status = http.StatusUnsupportedMediaType
+	case errors.Is(err, models.ErrTimeout):
+		status = http.StatusGatewayTimeout
+	}
+
+	body := models.Errors{Code: status, Reason: "internal_error", Message: "internal error", RequestID: logger.RequestID(r.Context())}
+	var domainErr *models.Error
+	if status != http.StatusInternalServerError && errors.As(err, &domainErr) {
+		body.Reason = domainErr.Code
+		body.Message = domainErr.Message
+		body.Fields = domainErr.Fields
+	}
+	log := logger.FromContext(r.Context())
+	switch {
+	case errors.Is(err, context.Canceled):
+		log.Info("request canceled by client", zap.Error(err))
+	case status >= http.StatusInternalServerError:
+		log.Error("request failed", zap.Error(err))
+	default:
+		log.Debug("request rejected", zap.Int("status", status), zap.Error(err))
+	}
+	writeJSON(w, status, models.ErrorResponse{Errors: body})
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+)
+
+// etag renders a subscription version as a strong entity tag.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// setETag echoes the version of the returned representation so clients can send it back in If-Match.
+func setETag(w http.ResponseWriter, m models.Subscription) {
+	w.Header().Set("ETag", etag(m.Version))
+}
+
+// parseIfMatch reads If-Match with the strong comparison RFC 9110 requires for it: weak or
+// malformed tags never match, so a header made only of those always fails the precondition.
+func parseIfMatch(r *http.Request) service.Precondition {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 { return service.Precondition{} }
+	pre := service.Precondition{Present: true}
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" {
+				pre.Any = true
+				continue
+			}
+			if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' { continue }
+			if n, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil { pre.Versions = append(pre.Versions, n) }
+		}
+	}
+	return pre
+}
+
+// precondition returns the If-Match condition for a write, rejecting blind writes when the
+// handlers are configured to require one.
+func (h *HandlersImpl) precondition(r *http.Request) (service.Precondition, error) {
+	pre := parseIfMatch(r)
+	if !pre.Present && h.requireIfMatch {
+		return pre, models.PreconditionRequired("if_match_required", "If-Match header with the current ETag is required")
+	}
+	return pre, nil
+}
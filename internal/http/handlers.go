@@ -3,44 +3,62 @@ package http
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"go.uber.org/zap"
 	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
 	"subscription-service/internal/service"
 )
 
 type HandlersImpl struct {
-	log *zap.Logger
-	svc *service.SubscriptionService
+	svc            *service.SubscriptionService
+	requireIfMatch bool
 }
 
-func NewHandlers(log *zap.Logger, svc *service.SubscriptionService) *HandlersImpl {
-	return &HandlersImpl{log: log, svc: svc}
+type HandlerOptions struct {
+	// RequireIfMatch makes PUT, PATCH and DELETE fail with 428 unless they carry If-Match.
+	RequireIfMatch bool
+}
+
+func NewHandlers(svc *service.SubscriptionService, opts HandlerOptions) *HandlersImpl {
+	return &HandlersImpl{svc: svc, requireIfMatch: opts.RequireIfMatch}
 }
 
 type CreateRequest struct {
-	ServiceName string    `json:"service_name"`
-	Price       int       `json:"price"`
-	UserID      uuid.UUID `json:"user_id"`
-	StartDate   string    `json:"start_date"`
-	EndDate     *string   `json:"end_date"`
+	ServiceName     string      `json:"service_name"`
+	// Price takes a JSON number or, to avoid float rounding in clients, a decimal string.
+	Price           json.Number `json:"price"`
+	UserID          uuid.UUID   `json:"user_id"`
+	StartDate       string      `json:"start_date"`
+	EndDate         *string     `json:"end_date"`
+	Currency        string      `json:"currency,omitempty"`
+	// BillingPeriod is weekly, monthly, quarterly or yearly; the price is charged once every
+	// BillingInterval periods.
+	BillingPeriod   string      `json:"billing_period,omitempty"`
+	BillingInterval *int        `json:"billing_interval,omitempty"`
 }
 
 type UpdateRequest = CreateRequest
 
 type SubscriptionDTO struct {
-	ID          uuid.UUID  `json:"id"`
-	ServiceName string     `json:"service_name"`
-	Price       int        `json:"price"`
-	UserID      uuid.UUID  `json:"user_id"`
-	StartDate   time.Time  `json:"start_date"`
-	EndDate     *time.Time `json:"end_date"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID              uuid.UUID  `json:"id"`
+	ServiceName     string     `json:"service_name"`
+	Price           Amount     `json:"price"`
+	UserID          uuid.UUID  `json:"user_id"`
+	StartDate       time.Time  `json:"start_date"`
+	EndDate         *time.Time `json:"end_date"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	Version         int64      `json:"version"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+	Currency        string     `json:"currency"`
+	BillingPeriod   string     `json:"billing_period"`
+	BillingInterval int        `json:"billing_interval"`
 }
 
 type SubscriptionResponse struct {
@@ -49,29 +67,78 @@ type SubscriptionResponse struct {
 
 type CreateResponse = SubscriptionResponse
 
-type ListQuery struct {
-	UserID      *uuid.UUID
-	ServiceName *string
-	From        *string
-	To          *string
-	Limit       int
-	Offset      int
-}
+type ListQuery = service.ListQuery
 
 type ListResponse struct {
 	Subscriptions []SubscriptionDTO `json:"subscriptions"`
 	Total         int               `json:"total"`
+	NextCursor    string            `json:"next_cursor,omitempty"`
+	PrevCursor    string            `json:"prev_cursor,omitempty"`
 }
 
-type TotalQuery struct {
-	UserID      *uuid.UUID
-	ServiceName *string
-	From        string
-	To          string
-}
+type TotalQuery = service.TotalQuery
 
 type TotalResponse struct {
-	Amount int `json:"amount"`
+	Amount        Amount            `json:"amount"`
+	Currency      string            `json:"currency,omitempty"`
+	Rates         []RateDTO         `json:"rates,omitempty"`
+	Contributions []ContributionDTO `json:"contributions,omitempty"`
+}
+
+type RateDTO struct {
+	Month    string `json:"month"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Rate     string `json:"rate"`
+	FromDate string `json:"from_rate_date,omitempty"`
+	ToDate   string `json:"to_rate_date,omitempty"`
+}
+
+type ContributionDTO struct {
+	SubscriptionID  uuid.UUID `json:"subscription_id"`
+	ServiceName     string    `json:"service_name"`
+	UserID          uuid.UUID `json:"user_id"`
+	Price           Amount    `json:"price"`
+	Currency        string    `json:"currency"`
+	StartMonth      string    `json:"start_month"`
+	EndMonth        string    `json:"end_month"`
+	Months          int       `json:"months"`
+	Charges         int       `json:"charges"`
+	BillingPeriod   string    `json:"billing_period"`
+	BillingInterval int       `json:"billing_interval"`
+	Amount          Amount    `json:"amount"`
+}
+
+type BucketDTO struct {
+	Key           string `json:"key"`
+	Amount        Amount `json:"amount"`
+	Currency      string `json:"currency,omitempty"`
+	Subscriptions int    `json:"subscriptions"`
+}
+
+type MoneyDTO struct {
+	Amount   Amount `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// BreakdownResponse has one bucket per key and currency. Amount and Currency add up all buckets
+// and are only present when they share one currency; Totals has the sum of every currency.
+type BreakdownResponse struct {
+	GroupBy  string      `json:"group_by"`
+	Amount   *Amount     `json:"amount,omitempty"`
+	Currency string      `json:"currency,omitempty"`
+	Totals   []MoneyDTO  `json:"totals"`
+	Buckets  []BucketDTO `json:"buckets"`
+}
+
+type SuggestionDTO struct {
+	ServiceName   string  `json:"service_name"`
+	Subscriptions int     `json:"subscriptions"`
+	Score         float64 `json:"score"`
+}
+
+type SuggestResponse struct {
+	Suggestions []SuggestionDTO `json:"suggestions"`
 }
 
 func writeJSON(w http.ResponseWriter, code int, payload any) {
@@ -83,127 +150,388 @@ func writeJSON(w http.ResponseWriter, code int, payload any) {
 func (h *HandlersImpl) Create(w http.ResponseWriter, r *http.Request) {
 	var req CreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": "invalid json"}})
+		h.writeError(w, r, models.BadRequest("invalid_json", "invalid json"))
 		return
 	}
-	sub, err := h.svc.Create(service.CreateInput{ServiceName: req.ServiceName, Price: req.Price, UserID: req.UserID, StartDate: req.StartDate, EndDate: req.EndDate})
+	in := service.CreateInput{ServiceName: req.ServiceName, Price: req.Price.String(), UserID: req.UserID, StartDate: req.StartDate, EndDate: req.EndDate, Currency: req.Currency,
+		BillingPeriod: req.BillingPeriod, BillingInterval: req.BillingInterval}
+	var sub models.Subscription
+	var err error
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		var replayed bool
+		sub, replayed, err = h.svc.CreateIdempotent(r.Context(), key, in)
+		if replayed { w.Header().Set("Idempotent-Replayed", "true") }
+	} else {
+		sub, err = h.svc.Create(r.Context(), in)
+	}
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": err.Error()}})
+		h.writeError(w, r, err)
 		return
 	}
-	writeJSON(w, http.StatusCreated, SubscriptionResponse{Subscription: toDTO(sub)})
+	setETag(w, sub)
+	writeJSON(w, http.StatusCreated, SubscriptionResponse{Subscription: toDTO(r, sub)})
 }
 
 func (h *HandlersImpl) GetByID(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": "invalid id"}})
+		h.writeError(w, r, models.BadRequest("invalid_id", "invalid id"))
 		return
 	}
-	sub, err := h.svc.GetByID(id)
+	var v service.Validator
+	var asOf *time.Time
+	if s := r.URL.Query().Get("as_of"); s != "" {
+		if t, ok := v.Timestamp("as_of", s); ok { asOf = &t }
+	}
+	if err := v.Err(); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if asOf != nil {
+		sub, err := h.svc.GetAsOf(r.Context(), id, *asOf)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, SubscriptionResponse{Subscription: toDTO(r, sub)})
+		return
+	}
+	sub, err := h.svc.GetByID(r.Context(), id)
 	if err != nil {
-		writeJSON(w, http.StatusNotFound, map[string]any{"errors": map[string]any{"code": 404, "message": err.Error()}})
+		h.writeError(w, r, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, SubscriptionResponse{Subscription: toDTO(sub)})
+	setETag(w, sub)
+	writeJSON(w, http.StatusOK, SubscriptionResponse{Subscription: toDTO(r, sub)})
 }
 
 func (h *HandlersImpl) Update(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": "invalid id"}})
+		h.writeError(w, r, models.BadRequest("invalid_id", "invalid id"))
+		return
+	}
+	pre, err := h.precondition(r)
+	if err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 	var req UpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": "invalid json"}})
+		h.writeError(w, r, models.BadRequest("invalid_json", "invalid json"))
 		return
 	}
-	sub, err := h.svc.Update(id, service.CreateInput{ServiceName: req.ServiceName, Price: req.Price, UserID: req.UserID, StartDate: req.StartDate, EndDate: req.EndDate})
+	sub, err := h.svc.Update(r.Context(), id, service.CreateInput{ServiceName: req.ServiceName, Price: req.Price.String(), UserID: req.UserID, StartDate: req.StartDate, EndDate: req.EndDate, Currency: req.Currency,
+		BillingPeriod: req.BillingPeriod, BillingInterval: req.BillingInterval}, pre)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": err.Error()}})
+		h.writeError(w, r, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, SubscriptionResponse{Subscription: toDTO(sub)})
+	setETag(w, sub)
+	writeJSON(w, http.StatusOK, SubscriptionResponse{Subscription: toDTO(r, sub)})
 }
 
 func (h *HandlersImpl) Delete(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": "invalid id"}})
+		h.writeError(w, r, models.BadRequest("invalid_id", "invalid id"))
+		return
+	}
+	pre, err := h.precondition(r)
+	if err != nil {
+		h.writeError(w, r, err)
 		return
 	}
-	if err := h.svc.Delete(id); err != nil {
-		writeJSON(w, http.StatusNotFound, map[string]any{"errors": map[string]any{"code": 404, "message": err.Error()}})
+	if err := h.svc.Delete(r.Context(), id, pre); err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusNoContent, nil)
 }
 
-func (h *HandlersImpl) List(w http.ResponseWriter, r *http.Request) {
+func (h *HandlersImpl) Restore(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, r, models.BadRequest("invalid_id", "invalid id"))
+		return
+	}
+	pre, err := h.precondition(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	sub, err := h.svc.Restore(r.Context(), id, pre)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	setETag(w, sub)
+	writeJSON(w, http.StatusOK, SubscriptionResponse{Subscription: toDTO(r, sub)})
+}
+
+func parseListQuery(r *http.Request) (ListQuery, error) {
+	var v service.Validator
+	params := r.URL.Query()
 	q := ListQuery{Limit: 50, Offset: 0}
-	if v := r.URL.Query().Get("limit"); v != "" {
-		if n, err := parseInt(v); err == nil { q.Limit = n }
+	if s := params.Get("limit"); s != "" {
+		if n, ok := v.Int("limit", s, 1, service.MaxListLimit); ok { q.Limit = n }
+	}
+	if s := params.Get("offset"); s != "" {
+		if n, ok := v.Int("offset", s, 0, math.MaxInt32); ok { q.Offset = n }
+	}
+	q.Sort = repository.DefaultSort
+	sortOK := true
+	if s := params.Get("sort"); s != "" {
+		var keys []repository.SortKey
+		if keys, sortOK = v.Sort("sort", s); sortOK { q.Sort = keys }
+	}
+	if s := params.Get("cursor"); s != "" && sortOK {
+		if c, ok := v.Cursor("cursor", s, q.Sort); ok { q.Cursor = &c }
+	}
+	for _, s := range params["service_name"] {
+		if s != "" { q.ServiceNames = append(q.ServiceNames, s) }
+	}
+	if s := params.Get("service_name_prefix"); s != "" { q.ServiceNamePrefix = &s }
+	q.Search = strings.TrimSpace(params.Get("q"))
+	for _, list := range params["user_id"] {
+		for _, s := range strings.Split(list, ",") {
+			if id, ok := v.UUID("user_id", strings.TrimSpace(s)); ok { q.UserIDs = append(q.UserIDs, id) }
+		}
+	}
+	if s := params.Get("from"); s != "" {
+		if t, ok := v.MonthYear("from", s); ok { q.From = &t }
+	}
+	if s := params.Get("to"); s != "" {
+		if t, ok := v.MonthYear("to", s); ok { q.To = &t }
+	}
+	if s := params.Get("price_min"); s != "" {
+		if n, ok := v.Int("price_min", s, 0, math.MaxInt32); ok { q.PriceMin = &n }
+	}
+	if s := params.Get("price_max"); s != "" {
+		if n, ok := v.Int("price_max", s, 0, math.MaxInt32); ok { q.PriceMax = &n }
 	}
-	if v := r.URL.Query().Get("offset"); v != "" {
-		if n, err := parseInt(v); err == nil { q.Offset = n }
+	if s := params.Get("active_at"); s != "" {
+		if t, ok := v.MonthYear("active_at", s); ok { q.ActiveAt = &t }
 	}
-	if v := r.URL.Query().Get("service_name"); v != "" { q.ServiceName = &v }
-	if v := r.URL.Query().Get("user_id"); v != "" {
-		if id, err := uuid.Parse(v); err == nil { q.UserID = &id }
+	q.Status = params.Get("status")
+	if s := params.Get("has_end_date"); s != "" {
+		if b, ok := v.Bool("has_end_date", s); ok { q.HasEndDate = &b }
 	}
-	if v := r.URL.Query().Get("from"); v != "" { q.From = &v }
-	if v := r.URL.Query().Get("to"); v != "" { q.To = &v }
+	if s := params.Get("created_after"); s != "" {
+		if t, ok := v.Timestamp("created_after", s); ok { q.CreatedAfter = &t }
+	}
+	if s := params.Get("created_before"); s != "" {
+		if t, ok := v.Timestamp("created_before", s); ok { q.CreatedBefore = &t }
+	}
+	if s := params.Get("as_of"); s != "" {
+		if t, ok := v.Timestamp("as_of", s); ok { q.AsOf = &t }
+	}
+	var includeDeleted, onlyDeleted bool
+	if s := params.Get("include_deleted"); s != "" { includeDeleted, _ = v.Bool("include_deleted", s) }
+	if s := params.Get("only_deleted"); s != "" { onlyDeleted, _ = v.Bool("only_deleted", s) }
+	switch {
+	case includeDeleted && onlyDeleted:
+		v.Add("only_deleted", service.CodeInvalidValue, "only_deleted cannot be combined with include_deleted")
+	case includeDeleted:
+		q.Deleted = repository.DeletedInclude
+	case onlyDeleted:
+		q.Deleted = repository.DeletedOnly
+	}
+	v.ListQuery(q)
+	return q, v.Err()
+}
 
-	list, total, err := h.svc.List(service.ListQuery{UserID: q.UserID, ServiceName: q.ServiceName, From: q.From, To: q.To, Limit: q.Limit, Offset: q.Offset})
+func (h *HandlersImpl) List(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": err.Error()}})
+		h.writeError(w, r, err)
 		return
 	}
-	dtos := make([]SubscriptionDTO, 0, len(list))
-	for _, m := range list { dtos = append(dtos, toDTO(m)) }
-	writeJSON(w, http.StatusOK, ListResponse{Subscriptions: dtos, Total: total})
+	page, err := h.svc.List(r.Context(), q)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	dtos := make([]SubscriptionDTO, 0, len(page.Items))
+	for _, m := range page.Items { dtos = append(dtos, toDTO(r, m)) }
+	if link := pageLinks(r, page.NextCursor, page.PrevCursor); link != "" { w.Header().Set("Link", link) }
+	writeJSON(w, http.StatusOK, ListResponse{Subscriptions: dtos, Total: page.Total, NextCursor: page.NextCursor, PrevCursor: page.PrevCursor})
 }
 
-func (h *HandlersImpl) Total(w http.ResponseWriter, r *http.Request) {
+// pageLinks builds an RFC 8288 Link header value pointing at the neighbouring cursor pages.
+func pageLinks(r *http.Request, next, prev string) string {
+	var links []string
+	for _, l := range []struct{ rel, cursor string }{{"next", next}, {"prev", prev}} {
+		if l.cursor == "" { continue }
+		u := *r.URL
+		q := u.Query()
+		q.Del("offset")
+		q.Set("cursor", l.cursor)
+		u.RawQuery = q.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), l.rel))
+	}
+	return strings.Join(links, ", ")
+}
+
+func parseTotalQuery(r *http.Request, v *service.Validator) TotalQuery {
 	var q TotalQuery
-	if v := r.URL.Query().Get("from"); v != "" { q.From = v } else {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": "from required"}}); return
+	fromOK, toOK := false, false
+	if s := r.URL.Query().Get("from"); v.Required("from", s) { q.From, fromOK = v.MonthYear("from", s) }
+	if s := r.URL.Query().Get("to"); v.Required("to", s) { q.To, toOK = v.MonthYear("to", s) }
+	if fromOK && toOK { v.Range("from", &q.From, &q.To, "to") }
+	if s := r.URL.Query().Get("service_name"); s != "" { q.ServiceName = &s }
+	if s := r.URL.Query().Get("user_id"); s != "" {
+		if id, ok := v.UUID("user_id", s); ok { q.UserID = &id }
+	}
+	if s := r.URL.Query().Get("include_deleted"); s != "" { q.IncludeDeleted, _ = v.Bool("include_deleted", s) }
+	if s := r.URL.Query().Get("as_of"); s != "" {
+		if t, ok := v.Timestamp("as_of", s); ok { q.AsOf = &t }
+	}
+	if s := r.URL.Query().Get("amortize"); s != "" { q.Amortize, _ = v.Bool("amortize", s) }
+	return q
+}
+
+func (h *HandlersImpl) Total(w http.ResponseWriter, r *http.Request) {
+	var v service.Validator
+	q := parseTotalQuery(r, &v)
+	if err := v.Err(); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	explain := r.URL.Query().Get("explain") == "true"
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		if explain {
+			h.writeError(w, r, models.InvalidFields([]models.FieldError{{Field: "explain", Code: service.CodeInvalidValue, Message: "explain is not available together with currency"}}))
+			return
+		}
+		h.convertedTotal(w, r, q, currency)
+		return
+	}
+	if explain {
+		h.explainTotal(w, r, q)
+		return
+	}
+	amount, err := h.svc.Total(r.Context(), q)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
 	}
-	if v := r.URL.Query().Get("to"); v != "" { q.To = v } else {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": "to required"}}); return
+	writeJSON(w, http.StatusOK, TotalResponse{Amount: amountOf(r, amount), Currency: amount.Currency})
+}
+
+func (h *HandlersImpl) convertedTotal(w http.ResponseWriter, r *http.Request, q TotalQuery, currency string) {
+	total, err := h.svc.TotalIn(r.Context(), q, currency)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
 	}
-	if v := r.URL.Query().Get("service_name"); v != "" { q.ServiceName = &v }
-	if v := r.URL.Query().Get("user_id"); v != "" {
-		if id, err := uuid.Parse(v); err == nil { q.UserID = &id }
+	resp := TotalResponse{Amount: amountOf(r, total.Amount), Currency: total.Amount.Currency, Rates: make([]RateDTO, 0, len(total.Rates))}
+	for _, rt := range total.Rates {
+		resp.Rates = append(resp.Rates, RateDTO{Month: rt.Month, From: rt.From, To: rt.To, Rate: rt.Rate, FromDate: rt.FromDate, ToDate: rt.ToDate})
 	}
-	amount, err := h.svc.Total(service.TotalQuery{UserID: q.UserID, ServiceName: q.ServiceName, From: q.From, To: q.To})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *HandlersImpl) explainTotal(w http.ResponseWriter, r *http.Request, q TotalQuery) {
+	amount, items, err := h.svc.Explain(r.Context(), q)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": map[string]any{"code": 400, "message": err.Error()}})
+		h.writeError(w, r, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, TotalResponse{Amount: amount})
+	resp := TotalResponse{Amount: amountOf(r, amount), Currency: amount.Currency, Contributions: make([]ContributionDTO, 0, len(items))}
+	for _, c := range items {
+		resp.Contributions = append(resp.Contributions, ContributionDTO{
+			SubscriptionID: c.SubscriptionID,
+			ServiceName: c.ServiceName,
+			UserID: c.UserID,
+			Price: amountOf(r, c.Price),
+			Currency: c.Price.Currency,
+			StartMonth: c.Start.Format("01-2006"),
+			EndMonth: c.End.Format("01-2006"),
+			Months: c.Months,
+			Charges: c.Charges,
+			BillingPeriod: c.BillingPeriod,
+			BillingInterval: c.BillingInterval,
+			Amount: amountOf(r, c.Amount),
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func parseInt(s string) (int, error) {
-	var n int
-	_, err := fmt.Sscanf(s, "%d", &n)
-	return n, err
+func (h *HandlersImpl) Breakdown(w http.ResponseWriter, r *http.Request) {
+	var v service.Validator
+	q := parseTotalQuery(r, &v)
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" { groupBy = repository.GroupByMonth }
+	switch groupBy {
+	case repository.GroupByMonth, repository.GroupByServiceName, repository.GroupByUserID:
+	default:
+		v.Add("group_by", service.CodeInvalidValue, "group_by must be one of month, service_name, user_id")
+	}
+	if err := v.Err(); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	res, err := h.svc.Breakdown(r.Context(), q, groupBy)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	resp := BreakdownResponse{GroupBy: groupBy, Totals: make([]MoneyDTO, 0, len(res.Totals)), Buckets: make([]BucketDTO, 0, len(res.Buckets))}
+	for _, t := range res.Totals { resp.Totals = append(resp.Totals, MoneyDTO{Amount: amountOf(r, t), Currency: t.Currency}) }
+	switch len(res.Totals) {
+	case 0:
+		zero := amountOf(r, models.Money{})
+		resp.Amount = &zero
+	case 1:
+		resp.Amount, resp.Currency = &resp.Totals[0].Amount, resp.Totals[0].Currency
+	}
+	for _, b := range res.Buckets {
+		resp.Buckets = append(resp.Buckets, BucketDTO{Key: b.Key, Amount: amountOf(r, b.Amount), Currency: b.Amount.Currency, Subscriptions: b.Subscriptions})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *HandlersImpl) SuggestServiceNames(w http.ResponseWriter, r *http.Request) {
+	var v service.Validator
+	limit := service.DefaultSuggestLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if n, ok := v.Int("limit", s, 1, service.MaxSuggestLimit); ok { limit = n }
+	}
+	if err := v.Err(); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	items, err := h.svc.SuggestServiceNames(r.Context(), r.URL.Query().Get("prefix"), limit)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	resp := SuggestResponse{Suggestions: make([]SuggestionDTO, 0, len(items))}
+	for _, s := range items {
+		resp.Suggestions = append(resp.Suggestions, SuggestionDTO{ServiceName: s.ServiceName, Subscriptions: s.Subscriptions, Score: s.Score})
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func toDTO(m models.Subscription) SubscriptionDTO {
+func toDTO(r *http.Request, m models.Subscription) SubscriptionDTO {
 	return SubscriptionDTO{
 		ID: m.ID,
 		ServiceName: m.ServiceName,
-		Price: m.Price,
+		Price: amountOf(r, m.Price),
 		UserID: m.UserID,
 		StartDate: m.StartDate,
 		EndDate: m.EndDate,
 		CreatedAt: m.CreatedAt,
 		UpdatedAt: m.UpdatedAt,
+		Version: m.Version,
+		DeletedAt: m.DeletedAt,
+		Currency: m.Price.Currency,
+		BillingPeriod: m.BillingPeriod,
+		BillingInterval: m.BillingInterval,
 	}
 }
 
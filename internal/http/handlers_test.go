@@ -0,0 +1,99 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	appdb "subscription-service/internal/db"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// testServer serves the API over the database named by SUBS_TEST_POSTGRES_DSN after migrating
+// it; tests that need Postgres are skipped without one.
+func testServer(t *testing.T) *Server {
+	t.Helper()
+	dsn := os.Getenv("SUBS_TEST_POSTGRES_DSN")
+	if dsn == "" { t.Skip("SUBS_TEST_POSTGRES_DSN is not set") }
+	ctx := context.Background()
+	t.Chdir("../..") // migrations are looked up relative to the repository root
+	if err := appdb.RunMigrations(ctx, dsn); err != nil { t.Fatalf("migrate: %v", err) }
+	pg, err := appdb.Connect(ctx, dsn, 1, 4)
+	if err != nil { t.Fatalf("connect: %v", err) }
+	t.Cleanup(pg.Close)
+	svc := service.NewSubscriptionService(repository.NewSubscriptionRepository(pg.Pool, repository.Timeouts{}), service.Options{})
+	srv := NewServer(zap.NewNop(), nil)
+	srv.RegisterRoutes(NewHandlers(svc, HandlerOptions{}))
+	return srv
+}
+
+// call sends a request to srv and decodes a JSON response body into out, when given.
+func call(t *testing.T, srv *Server, method, path, body string, out any) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.Router.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil { t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err) }
+	}
+	return rec
+}
+
+// testSubscription is the part of a subscription response the tests look at; Amount is write-only.
+type testSubscription struct {
+	ID        uuid.UUID  `json:"id"`
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+func createSubscription(t *testing.T, srv *Server) testSubscription {
+	t.Helper()
+	var created struct{ Subscription testSubscription }
+	body := `{"service_name":"Restore","price":199,"user_id":"` + uuid.NewString() + `","start_date":"01-2024"}`
+	if rec := call(t, srv, http.MethodPost, "/api/v1/subscriptions/", body, &created); rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body.String())
+	}
+	return created.Subscription
+}
+
+func TestRestore(t *testing.T) {
+	srv := testServer(t)
+	restore := func(id string) (int, string) {
+		var resp models.ErrorResponse
+		rec := call(t, srv, http.MethodPost, "/api/v1/subscriptions/"+id+"/restore", "", &resp)
+		return rec.Code, resp.Errors.Reason
+	}
+
+	t.Run("live subscription", func(t *testing.T) {
+		sub := createSubscription(t, srv)
+		if code, reason := restore(sub.ID.String()); code != http.StatusConflict || reason != "subscription_not_deleted" {
+			t.Fatalf("restore = %d %s, want 409 subscription_not_deleted", code, reason)
+		}
+	})
+	t.Run("missing subscription", func(t *testing.T) {
+		if code, reason := restore(uuid.NewString()); code != http.StatusNotFound || reason != "subscription_not_found" {
+			t.Fatalf("restore = %d %s, want 404 subscription_not_found", code, reason)
+		}
+	})
+	t.Run("deleted subscription", func(t *testing.T) {
+		sub := createSubscription(t, srv)
+		if rec := call(t, srv, http.MethodDelete, "/api/v1/subscriptions/"+sub.ID.String(), "", nil); rec.Code >= 300 {
+			t.Fatalf("delete: %d %s", rec.Code, rec.Body.String())
+		}
+		var restored struct{ Subscription testSubscription }
+		rec := call(t, srv, http.MethodPost, "/api/v1/subscriptions/"+sub.ID.String()+"/restore", "", &restored)
+		if rec.Code != http.StatusOK || restored.Subscription.DeletedAt != nil {
+			t.Fatalf("restore = %d %s, want 200 and a live subscription", rec.Code, rec.Body.String())
+		}
+	})
+}
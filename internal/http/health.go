@@ -0,0 +1,101 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	appdb "subscription-service/internal/db"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+type CheckResult struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+}
+
+type MigrationsResult struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Current int64  `json:"current"`
+	Latest  int64  `json:"latest"`
+}
+
+type PoolStats struct {
+	TotalConns        int32 `json:"total_conns"`
+	AcquiredConns     int32 `json:"acquired_conns"`
+	IdleConns         int32 `json:"idle_conns"`
+	MaxConns          int32 `json:"max_conns"`
+	AcquireCount      int64 `json:"acquire_count"`
+	EmptyAcquireCount int64 `json:"empty_acquire_count"`
+	AcquireDurationMs int64 `json:"acquire_duration_ms"`
+}
+
+type ReadinessReport struct {
+	Status     string           `json:"status"`
+	Accepting  bool             `json:"accepting"`
+	Postgres   CheckResult      `json:"postgres"`
+	Migrations MigrationsResult `json:"migrations"`
+	Pool       PoolStats        `json:"pool"`
+}
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// RegisterHealth mounts /healthz, which only says the process is serving, and /readyz, which
+// checks the database and migrations and fails while the server is starting or shutting down.
+func (s *Server) RegisterHealth(db *appdb.Postgres) {
+	s.Router.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": statusOK})
+	})
+	s.Router.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := s.readiness(r.Context(), db)
+		code := http.StatusOK
+		if report.Status != statusOK { code = http.StatusServiceUnavailable }
+		writeJSON(w, code, report)
+	})
+}
+
+func (s *Server) readiness(ctx context.Context, db *appdb.Postgres) ReadinessReport {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	report := ReadinessReport{Status: statusOK, Accepting: s.Ready()}
+	if !report.Accepting { report.Status = statusUnavailable }
+
+	start := time.Now()
+	if err := db.Pool.Ping(ctx); err != nil {
+		report.Status = statusUnavailable
+		report.Postgres = CheckResult{Status: statusUnavailable, Error: err.Error()}
+	} else {
+		report.Postgres = CheckResult{Status: statusOK, LatencyMs: time.Since(start).Milliseconds()}
+	}
+
+	current, latest, err := db.MigrationVersions(ctx)
+	switch {
+	case err != nil:
+		report.Status = statusUnavailable
+		report.Migrations = MigrationsResult{Status: statusUnavailable, Error: err.Error()}
+	case current < latest:
+		report.Status = statusUnavailable
+		report.Migrations = MigrationsResult{Status: "pending", Current: current, Latest: latest}
+	default:
+		report.Migrations = MigrationsResult{Status: statusOK, Current: current, Latest: latest}
+	}
+
+	st := db.Pool.Stat()
+	report.Pool = PoolStats{
+		TotalConns:        st.TotalConns(),
+		AcquiredConns:     st.AcquiredConns(),
+		IdleConns:         st.IdleConns(),
+		MaxConns:          st.MaxConns(),
+		AcquireCount:      st.AcquireCount(),
+		EmptyAcquireCount: st.EmptyAcquireCount(),
+		AcquireDurationMs: st.AcquireDuration().Milliseconds(),
+	}
+	return report
+}
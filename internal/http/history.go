@@ -0,0 +1,76 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+)
+
+// EventDTO renders the snapshots like the subscription resource of the same API version,
+// whatever shape they were stored in.
+type EventDTO struct {
+	ID         int64            `json:"id"`
+	Type       string           `json:"type"`
+	Actor      string           `json:"actor,omitempty"`
+	RequestID  string           `json:"request_id,omitempty"`
+	Before     *SubscriptionDTO `json:"before"`
+	After      *SubscriptionDTO `json:"after"`
+	// PriceChange is what a price_changed event changed.
+	PriceChange *PriceChangeDTO `json:"price_change,omitempty"`
+	OccurredAt time.Time        `json:"occurred_at"`
+}
+
+type PriceChangeDTO struct {
+	EffectiveFrom string `json:"effective_from"`
+	Price         Amount `json:"price"`
+	Currency      string `json:"currency"`
+}
+
+type HistoryResponse struct {
+	Events     []EventDTO `json:"events"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+func (h *HandlersImpl) History(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, r, models.BadRequest("invalid_id", "invalid id"))
+		return
+	}
+	var v service.Validator
+	q := service.HistoryQuery{Limit: 50, Cursor: r.URL.Query().Get("cursor")}
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if n, ok := v.Int("limit", s, 1, service.MaxListLimit); ok { q.Limit = n }
+	}
+	if err := v.Err(); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	page, err := h.svc.History(r.Context(), id, q)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	resp := HistoryResponse{Events: make([]EventDTO, 0, len(page.Events)), NextCursor: page.NextCursor}
+	for _, e := range page.Events {
+		dto := EventDTO{ID: e.ID, Type: e.Type, Actor: e.Actor, RequestID: e.RequestID, OccurredAt: e.OccurredAt}
+		if e.Before != nil {
+			before := toDTO(r, *e.Before)
+			dto.Before = &before
+		}
+		if e.After != nil {
+			after := toDTO(r, *e.After)
+			dto.After = &after
+		}
+		if c := e.PriceChange; c != nil {
+			dto.PriceChange = &PriceChangeDTO{EffectiveFrom: c.EffectiveFrom, Price: amountOf(r, c.Price), Currency: c.Price.Currency}
+		}
+		resp.Events = append(resp.Events, dto)
+	}
+	if link := pageLinks(r, page.NextCursor, ""); link != "" { w.Header().Set("Link", link) }
+	writeJSON(w, http.StatusOK, resp)
+}
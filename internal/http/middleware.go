@@ -2,25 +2,68 @@ package http
 
 import (
 	"net/http"
+	"regexp"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"subscription-service/internal/logger"
 )
 
+const (
+	RequestIDHeader = "X-Request-ID"
+	// ActorHeader names who performs the request; it is set by the gateway in front of the
+	// service and recorded in the audit trail.
+	ActorHeader = "X-Actor"
+)
+
+var (
+	validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+	validActor     = regexp.MustCompile(`^[A-Za-z0-9._:@+-]{1,128}$`)
+)
+
+// RequestIDMiddleware accepts the caller's X-Request-ID or generates one, echoes it back and
+// stores it in the context together with a logger that carries it. A well-formed X-Actor is
+// stored alongside.
+func RequestIDMiddleware(l *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID.MatchString(id) { id = uuid.NewString() }
+			w.Header().Set(RequestIDHeader, id)
+			fields := []zap.Field{zap.String("request_id", id)}
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+			}
+			ctx := logger.WithRequestID(r.Context(), id)
+			if actor := r.Header.Get(ActorHeader); validActor.MatchString(actor) {
+				ctx = logger.WithActor(ctx, actor)
+				fields = append(fields, zap.String("actor", actor))
+			}
+			ctx = logger.WithContext(ctx, l.With(fields...))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 func LoggingMiddleware(l *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			next.ServeHTTP(w, r)
-			l.Info("request",
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+			status := ww.Status()
+			if status == 0 { status = http.StatusOK }
+			logger.FromContext(r.Context()).Info("request",
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
 				zap.String("remote", r.RemoteAddr),
+				zap.Int("status", status),
+				zap.Int("bytes", ww.BytesWritten()),
 				zap.Duration("duration", time.Since(start)),
 			)
 		})
 	}
 }
-
-
-
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"subscription-service/internal/models"
+)
+
+type apiVersionKey struct{}
+
+// withAPIVersion marks the requests of a versioned route group; the version only changes how
+// responses are shaped.
+func withAPIVersion(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+		})
+	}
+}
+
+func apiVersion(r *http.Request) int {
+	if v, ok := r.Context().Value(apiVersionKey{}).(int); ok { return v }
+	return 1
+}
+
+// Amount is money in a response. v1 keeps the JSON number of major units it always returned,
+// with a fraction only when there is one; v2 writes a decimal string with every minor digit,
+// e.g. "199.00", so that no client reads it into a float.
+type Amount struct {
+	money   models.Money
+	decimal bool
+}
+
+func amountOf(r *http.Request, m models.Money) Amount {
+	return Amount{money: m, decimal: apiVersion(r) >= 2}
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	s := a.money.String()
+	if a.decimal { return json.Marshal(s) }
+	if strings.Contains(s, ".") { s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".") }
+	return []byte(s), nil
+}
@@ -0,0 +1,33 @@
+package http
+
+import (
+	"encoding/json"
+	"testing"
+
+	"subscription-service/internal/models"
+)
+
+func TestAmountMarshalJSON(t *testing.T) {
+	cases := []struct {
+		m      models.Money
+		v1, v2 string
+	}{
+		{models.Money{Amount: 19900, Currency: "RUB"}, `199`, `"199.00"`},
+		{models.Money{Amount: 19950, Currency: "RUB"}, `199.5`, `"199.50"`},
+		{models.Money{Amount: 19999, Currency: "USD"}, `199.99`, `"199.99"`},
+		{models.Money{Amount: -5, Currency: "RUB"}, `-0.05`, `"-0.05"`},
+		{models.Money{Amount: 0}, `0`, `"0.00"`},
+		{models.Money{Amount: 1500, Currency: "JPY"}, `1500`, `"1500"`},
+		{models.Money{Amount: 1000, Currency: "KWD"}, `1`, `"1.000"`},
+		{models.Money{Amount: 1230, Currency: "KWD"}, `1.23`, `"1.230"`},
+	}
+	for _, tc := range cases {
+		for _, a := range []struct {
+			amount Amount
+			want   string
+		}{{Amount{money: tc.m}, tc.v1}, {Amount{money: tc.m, decimal: true}, tc.v2}} {
+			b, err := json.Marshal(a.amount)
+			if err != nil || string(b) != a.want { t.Errorf("Marshal(%+v, decimal=%v) = %s, %v, want %s", tc.m, a.amount.decimal, b, err, a.want) }
+		}
+	}
+}
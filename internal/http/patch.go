@@ -0,0 +1,110 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+)
+
+const mergePatchMediaType = "application/merge-patch+json"
+
+// Patch applies an RFC 7396 JSON Merge Patch: omitted members stay untouched and an explicit
+// null clears end_date. Plain application/json is accepted as well for clients that can't set
+// the merge patch media type.
+func (h *HandlersImpl) Patch(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, r, models.BadRequest("invalid_id", "invalid id"))
+		return
+	}
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt != mergePatchMediaType && mt != "application/json" {
+		w.Header().Set("Accept-Patch", mergePatchMediaType)
+		h.writeError(w, r, models.UnsupportedMediaType("unsupported_media_type", "content type must be "+mergePatchMediaType))
+		return
+	}
+	pre, err := h.precondition(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	p, err := decodeMergePatch(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	sub, err := h.svc.Patch(r.Context(), id, p, pre)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	setETag(w, sub)
+	writeJSON(w, http.StatusOK, SubscriptionResponse{Subscription: toDTO(r, sub)})
+}
+
+func decodeMergePatch(r *http.Request) (service.PatchInput, error) {
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil || doc == nil {
+		return service.PatchInput{}, models.BadRequest("invalid_json", "merge patch must be a JSON object")
+	}
+	var v service.Validator
+	var p service.PatchInput
+	for _, field := range slices.Sorted(maps.Keys(doc)) {
+		raw := doc[field]
+		isNull := bytes.Equal(raw, []byte("null"))
+		if isNull && field != "end_date" && knownPatchField(field) {
+			v.Add(field, service.CodeRequired, field+" cannot be null")
+			continue
+		}
+		var err error
+		switch field {
+		case "service_name":
+			p.ServiceName = new(string)
+			err = json.Unmarshal(raw, p.ServiceName)
+		case "price":
+			var n json.Number
+			if err = json.Unmarshal(raw, &n); err == nil { p.Price = (*string)(&n) }
+		case "user_id":
+			p.UserID = new(uuid.UUID)
+			err = json.Unmarshal(raw, p.UserID)
+		case "start_date":
+			p.StartDate = new(string)
+			err = json.Unmarshal(raw, p.StartDate)
+		case "currency":
+			p.Currency = new(string)
+			err = json.Unmarshal(raw, p.Currency)
+		case "billing_period":
+			p.BillingPeriod = new(string)
+			err = json.Unmarshal(raw, p.BillingPeriod)
+		case "billing_interval":
+			p.BillingInterval = new(int)
+			err = json.Unmarshal(raw, p.BillingInterval)
+		case "end_date":
+			p.EndDateSet = true
+			if !isNull {
+				p.EndDate = new(string)
+				err = json.Unmarshal(raw, p.EndDate)
+			}
+		default:
+			v.Add(field, service.CodeUnknownField, field+" is not a patchable field")
+		}
+		if err != nil { v.Add(field, service.CodeInvalidFormat, field+" has an invalid type or format") }
+	}
+	return p, v.Err()
+}
+
+func knownPatchField(field string) bool {
+	switch field {
+	case "service_name", "price", "user_id", "start_date", "end_date", "currency", "billing_period", "billing_interval":
+		return true
+	}
+	return false
+}
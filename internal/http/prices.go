@@ -0,0 +1,70 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+)
+
+type PriceChangeRequest struct {
+	EffectiveFrom string      `json:"effective_from"`
+	Price         json.Number `json:"price"`
+}
+
+type PricePointDTO struct {
+	EffectiveFrom string `json:"effective_from"`
+	Price         Amount `json:"price"`
+}
+
+type PricesResponse struct {
+	Prices []PricePointDTO `json:"prices"`
+}
+
+func (h *HandlersImpl) AddPriceChange(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, r, models.BadRequest("invalid_id", "invalid id"))
+		return
+	}
+	pre, err := h.precondition(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	var req PriceChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, models.BadRequest("invalid_json", "invalid json"))
+		return
+	}
+	sub, timeline, err := h.svc.AddPriceChange(r.Context(), id, service.PriceChangeInput{EffectiveFrom: req.EffectiveFrom, Price: req.Price.String()}, pre)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	setETag(w, sub)
+	writeJSON(w, http.StatusCreated, toPricesResponse(r, timeline))
+}
+
+func (h *HandlersImpl) ListPrices(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, r, models.BadRequest("invalid_id", "invalid id"))
+		return
+	}
+	timeline, err := h.svc.PriceTimeline(r.Context(), id)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toPricesResponse(r, timeline))
+}
+
+func toPricesResponse(r *http.Request, timeline []service.PricePoint) PricesResponse {
+	resp := PricesResponse{Prices: make([]PricePointDTO, 0, len(timeline))}
+	for _, p := range timeline { resp.Prices = append(resp.Prices, PricePointDTO{EffectiveFrom: p.EffectiveFrom, Price: amountOf(r, p.Price)}) }
+	return resp
+}
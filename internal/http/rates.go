@@ -0,0 +1,37 @@
+package http
+
+import (
+	"mime"
+	"net/http"
+
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+)
+
+// maxRatesFileBytes bounds an uploaded rates file; the full ECB history is a few megabytes.
+const maxRatesFileBytes = 32 << 20
+
+type LoadRatesResponse struct {
+	Loaded int `json:"loaded"`
+}
+
+// LoadExchangeRates stores reference rates posted as text/csv or ECB-style XML.
+func (h *HandlersImpl) LoadExchangeRates(w http.ResponseWriter, r *http.Request) {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var format string
+	switch mt {
+	case "text/csv":
+		format = service.RatesFormatCSV
+	case "application/xml", "text/xml":
+		format = service.RatesFormatXML
+	default:
+		h.writeError(w, r, models.UnsupportedMediaType("unsupported_media_type", "content type must be text/csv or application/xml"))
+		return
+	}
+	n, err := h.svc.LoadExchangeRates(r.Context(), http.MaxBytesReader(w, r.Body, maxRatesFileBytes), format)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, LoadRatesResponse{Loaded: n})
+}
@@ -2,33 +2,64 @@ package http
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
+	"subscription-service/internal/metrics"
+	"subscription-service/internal/tracing"
 )
 
 type Server struct {
 	Router *chi.Mux
 	Log    *zap.Logger
+	ready  atomic.Bool
 }
 
-func NewServer(log *zap.Logger) *Server {
+func NewServer(log *zap.Logger, m *metrics.Metrics) *Server {
 	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Use(RequestIDMiddleware(log))
 	r.Use(LoggingMiddleware(log))
+	if m != nil {
+		r.Use(m.Middleware)
+		r.Handle("/metrics", m.Handler())
+	}
 
 	return &Server{Router: r, Log: log}
 }
 
+// SetReady flips whether the server should receive traffic; it is false until startup completes
+// and goes back to false as soon as shutdown begins.
+func (s *Server) SetReady(ready bool) { s.ready.Store(ready) }
+
+func (s *Server) Ready() bool { return s.ready.Load() }
+
 func (s *Server) RegisterRoutes(h Handlers) {
-	s.Router.Route("/api/v1", func(r chi.Router) {
-		r.Route("/subscriptions", func(r chi.Router) {
-			r.Get("/total", h.Total)
-			r.Post("/", h.Create)
-			r.Get("/", h.List)
-			r.Get("/{id}", h.GetByID)
-			r.Put("/{id}", h.Update)
-			r.Delete("/{id}", h.Delete)
-		})
+	s.Router.Route("/api/v1", func(r chi.Router) { apiRoutes(r, h) })
+	// v2 serves the same endpoints but writes money as decimal strings.
+	s.Router.Route("/api/v2", func(r chi.Router) {
+		r.Use(withAPIVersion(2))
+		apiRoutes(r, h)
+	})
+}
+
+func apiRoutes(r chi.Router, h Handlers) {
+	r.Post("/exchange-rates", h.LoadExchangeRates)
+	r.Route("/subscriptions", func(r chi.Router) {
+		r.Get("/total", h.Total)
+		r.Get("/breakdown", h.Breakdown)
+		r.Get("/service-names/suggest", h.SuggestServiceNames)
+		r.Post("/", h.Create)
+		r.Get("/", h.List)
+		r.Get("/{id}", h.GetByID)
+		r.Put("/{id}", h.Update)
+		r.Patch("/{id}", h.Patch)
+		r.Delete("/{id}", h.Delete)
+		r.Post("/{id}/restore", h.Restore)
+		r.Get("/{id}/history", h.History)
+		r.Get("/{id}/prices", h.ListPrices)
+		r.Post("/{id}/prices", h.AddPriceChange)
 	})
 }
 
@@ -36,9 +67,17 @@ type Handlers interface {
 	Create(w http.ResponseWriter, r *http.Request)
 	GetByID(w http.ResponseWriter, r *http.Request)
 	Update(w http.ResponseWriter, r *http.Request)
+	Patch(w http.ResponseWriter, r *http.Request)
 	Delete(w http.ResponseWriter, r *http.Request)
+	Restore(w http.ResponseWriter, r *http.Request)
+	History(w http.ResponseWriter, r *http.Request)
+	ListPrices(w http.ResponseWriter, r *http.Request)
+	AddPriceChange(w http.ResponseWriter, r *http.Request)
+	LoadExchangeRates(w http.ResponseWriter, r *http.Request)
 	List(w http.ResponseWriter, r *http.Request)
 	Total(w http.ResponseWriter, r *http.Request)
+	Breakdown(w http.ResponseWriter, r *http.Request)
+	SuggestServiceNames(w http.ResponseWriter, r *http.Request)
 }
 
 
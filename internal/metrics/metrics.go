@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const namespace = "subscription_service"
+
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	duration        *prometheus.HistogramVec
+	activeByService *prometheus.GaugeVec
+	spendByService  *prometheus.GaugeVec
+	refreshedAt     prometheus.Gauge
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "http_requests_total",
+			Help: "HTTP requests by method, chi route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "http_request_duration_seconds",
+			Help:    "HTTP request latency by method, chi route pattern and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		activeByService: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "active_subscriptions",
+			Help: "Subscriptions active in the current month by service.",
+		}, []string{"service_name"}),
+		spendByService: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "monthly_recurring_spend",
+			Help: "Spend for the current month by service and currency, in major units, with charges of longer billing cycles amortized over their months.",
+		}, []string{"service_name", "currency"}),
+		refreshedAt: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "business_metrics_refreshed_timestamp_seconds",
+			Help: "Unix time of the last successful business metrics refresh.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.duration, m.activeByService, m.spendByService, m.refreshedAt,
+	)
+	return m
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware records request count and latency labelled by the matched chi route pattern,
+// so /subscriptions/{id} is one series instead of one per id.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 { status = http.StatusOK }
+		labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.duration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RegisterPool exposes pgxpool statistics, read on every scrape.
+func (m *Metrics) RegisterPool(pool *pgxpool.Pool) {
+	m.registry.MustRegister(&poolCollector{pool: pool})
+}
+
+// ServiceSpend is the spend of a service in one currency; a service billed in several currencies
+// has one ServiceSpend for each.
+type ServiceSpend struct {
+	ServiceName   string
+	Currency      string
+	Subscriptions int
+	// Amount is in major units of Currency, e.g. rubles rather than kopecks.
+	Amount        float64
+}
+
+// RunBusinessRefresh reloads the business gauges every interval until ctx is canceled.
+// A non-positive interval disables the refresh.
+func (m *Metrics) RunBusinessRefresh(ctx context.Context, log *zap.Logger, interval time.Duration, load func(context.Context) ([]ServiceSpend, error)) {
+	if interval <= 0 { return }
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if items, err := load(ctx); err != nil {
+			if ctx.Err() == nil { log.Warn("refresh business metrics", zap.Error(err)) }
+		} else {
+			m.activeByService.Reset()
+			m.spendByService.Reset()
+			for _, it := range items {
+				m.activeByService.WithLabelValues(it.ServiceName).Add(float64(it.Subscriptions))
+				m.spendByService.WithLabelValues(it.ServiceName, it.Currency).Set(it.Amount)
+			}
+			m.refreshedAt.SetToCurrentTime()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
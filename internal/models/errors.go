@@ -1,9 +1,92 @@
 package models
 
-type Errors struct {
-	Code    int    `json:"code"`
+import "errors"
+
+var (
+	ErrBadRequest           = errors.New("bad request")
+	ErrNotFound             = errors.New("not found")
+	ErrValidation           = errors.New("validation failed")
+	ErrConflict             = errors.New("conflict")
+	ErrPrecondition         = errors.New("precondition failed")
+	ErrPreconditionRequired = errors.New("precondition required")
+	ErrTimeout              = errors.New("timeout")
+	ErrMediaType            = errors.New("unsupported media type")
+	ErrInternal             = errors.New("internal error")
+)
+
+// Error is a domain error. Kind is one of the Err* sentinels, so callers match it with errors.Is,
+// and Code is a stable machine-readable identifier returned to API clients.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
 	Message string `json:"message"`
-	Details string `json:"details"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil { return e.Message + ": " + e.Err.Error() }
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil { return []error{e.Kind, e.Err} }
+	return []error{e.Kind}
+}
+
+func BadRequest(code, message string) error {
+	return &Error{Kind: ErrBadRequest, Code: code, Message: message}
+}
+
+func NotFound(code, message string) error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: message}
+}
+
+func Validation(code, message string) error {
+	return &Error{Kind: ErrValidation, Code: code, Message: message}
+}
+
+func InvalidFields(fields []FieldError) error {
+	return &Error{Kind: ErrValidation, Code: "validation_failed", Message: "request validation failed", Fields: fields}
+}
+
+func Conflict(code, message string, err error) error {
+	return &Error{Kind: ErrConflict, Code: code, Message: message, Err: err}
+}
+
+func UnsupportedMediaType(code, message string) error {
+	return &Error{Kind: ErrMediaType, Code: code, Message: message}
+}
+
+func PreconditionFailed(code, message string) error {
+	return &Error{Kind: ErrPrecondition, Code: code, Message: message}
+}
+
+func PreconditionRequired(code, message string) error {
+	return &Error{Kind: ErrPreconditionRequired, Code: code, Message: message}
+}
+
+func Timeout(message string, err error) error {
+	return &Error{Kind: ErrTimeout, Code: "timeout", Message: message + " timed out", Err: err}
+}
+
+func Internal(message string, err error) error {
+	return &Error{Kind: ErrInternal, Code: "internal_error", Message: message, Err: err}
+}
+
+type Errors struct {
+	Code      int          `json:"code"`
+	Reason    string       `json:"reason"`
+	Message   string       `json:"message"`
+	Details   string       `json:"details"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in the minor units of its currency (kopecks, cents), so sums are exact.
+// Arithmetic is checked and fails instead of wrapping around.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// minorUnits lists the ISO 4217 currencies whose minor unit is not a hundredth. Keep it in
+// sync with currency_exponent() in migrations/0012_money.sql.
+var minorUnits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Exponent returns the number of decimal digits of the minor unit of currency.
+func Exponent(currency string) int {
+	if e, ok := minorUnits[currency]; ok { return e }
+	return 2
+}
+
+var (
+	ErrMoneyFormat    = errors.New("must be a decimal number such as 199 or 199.99")
+	ErrMoneyPrecision = errors.New("has more decimal places than the currency allows")
+	ErrMoneyOverflow  = errors.New("is too large")
+)
+
+// ParseMoney reads a decimal amount in major units, e.g. "199.99" RUB is 19999 kopecks.
+// Trailing zeros beyond the currency's precision are accepted.
+func ParseMoney(s, currency string) (Money, error) {
+	neg := strings.HasPrefix(s, "-")
+	whole, frac, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if !isDigits(whole) || (frac != "" || strings.HasSuffix(s, ".")) && !isDigits(frac) { return Money{}, ErrMoneyFormat }
+	exp := Exponent(currency)
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > exp { return Money{}, ErrMoneyPrecision }
+	digits := strings.TrimLeft(whole+frac+strings.Repeat("0", exp-len(frac)), "0")
+	if digits == "" { return Money{Currency: currency}, nil }
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil { return Money{}, ErrMoneyOverflow }
+	if neg { n = -n }
+	return Money{Amount: n, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" { return false }
+	for _, c := range s {
+		if c < '0' || c > '9' { return false }
+	}
+	return true
+}
+
+// AmountOverflow reports an amount or sum that does not fit into int64 minor units.
+func AmountOverflow() error {
+	return Validation("amount_overflow", "amount does not fit into a 64-bit integer")
+}
+
+// Add returns m+o. Both must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency { return Money{}, Internal("add money", fmt.Errorf("currency mismatch: %s and %s", m.Currency, o.Currency)) }
+	sum := m.Amount + o.Amount
+	if (sum > m.Amount) != (o.Amount > 0) { return Money{}, AmountOverflow() }
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// RoundMoney rounds an exact number of minor units of currency half away from zero.
+func RoundMoney(r *big.Rat, currency string) (Money, error) {
+	num, den := new(big.Int).Set(r.Num()), r.Denom()
+	twice := new(big.Int).Mul(num.Abs(num), big.NewInt(2))
+	q := new(big.Int).Quo(twice.Add(twice, den), new(big.Int).Mul(den, big.NewInt(2)))
+	if r.Sign() < 0 { q.Neg(q) }
+	if !q.IsInt64() { return Money{}, AmountOverflow() }
+	return Money{Amount: q.Int64(), Currency: currency}, nil
+}
+
+// String formats m in major units with all minor digits, e.g. "199.00".
+func (m Money) String() string {
+	exp := Exponent(m.Currency)
+	digits := strconv.FormatUint(absAmount(m.Amount), 10)
+	if len(digits) <= exp { digits = strings.Repeat("0", exp-len(digits)+1) + digits }
+	sign := ""
+	if m.Amount < 0 { sign = "-" }
+	if exp == 0 { return sign + digits }
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+func absAmount(n int64) uint64 {
+	if n < 0 { return uint64(-(n + 1)) + 1 }
+	return uint64(n)
+}
+
+// Float64 approximates m in major units, for metrics and other places where exactness does not matter.
+func (m Money) Float64() float64 {
+	return float64(m.Amount) / math.Pow10(Exponent(m.Currency))
+}
+
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON writes {"amount":"199.99","currency":"RUB"}; the amount is a string so that no
+// client parses it into a float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.String(), Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var v moneyJSON
+	if err := json.Unmarshal(b, &v); err != nil { return err }
+	parsed, err := ParseMoney(v.Amount, v.Currency)
+	if err != nil { return fmt.Errorf("amount %q %w", v.Amount, err) }
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		in, currency string
+		want         int64
+		err          error
+	}{
+		{"199", "RUB", 19900, nil},
+		{"199.99", "RUB", 19999, nil},
+		{"199.9", "RUB", 19990, nil},
+		{"007", "RUB", 700, nil},
+		{"0.00", "RUB", 0, nil},
+		{"-5.5", "RUB", -550, nil},
+		{"199.990", "RUB", 19999, nil},
+		{"1.001", "RUB", 0, ErrMoneyPrecision},
+		{"1500", "JPY", 1500, nil},
+		{"1500.0", "JPY", 1500, nil},
+		{"1500.5", "JPY", 0, ErrMoneyPrecision},
+		{"-1500", "JPY", -1500, nil},
+		{"1.234", "KWD", 1234, nil},
+		{"1.2340", "KWD", 1234, nil},
+		{"1.2345", "KWD", 0, ErrMoneyPrecision},
+		{"92233720368547758.07", "RUB", math.MaxInt64, nil},
+		{"92233720368547758.08", "RUB", 0, ErrMoneyOverflow},
+		{"9223372036854775808", "JPY", 0, ErrMoneyOverflow},
+		{"", "RUB", 0, ErrMoneyFormat},
+		{"-", "RUB", 0, ErrMoneyFormat},
+		{"1.", "RUB", 0, ErrMoneyFormat},
+		{".5", "RUB", 0, ErrMoneyFormat},
+		{"1e3", "RUB", 0, ErrMoneyFormat},
+		{"+1", "RUB", 0, ErrMoneyFormat},
+		{"1,5", "RUB", 0, ErrMoneyFormat},
+		{"--1", "RUB", 0, ErrMoneyFormat},
+	}
+	for _, tc := range cases {
+		got, err := ParseMoney(tc.in, tc.currency)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("ParseMoney(%q, %s) error = %v, want %v", tc.in, tc.currency, err, tc.err)
+			continue
+		}
+		if err == nil && got != (Money{Amount: tc.want, Currency: tc.currency}) {
+			t.Errorf("ParseMoney(%q, %s) = %+v, want %d", tc.in, tc.currency, got, tc.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	cases := []struct {
+		m    Money
+		want string
+	}{
+		{Money{19999, "RUB"}, "199.99"},
+		{Money{19900, "RUB"}, "199.00"},
+		{Money{5, "RUB"}, "0.05"},
+		{Money{-5, "RUB"}, "-0.05"},
+		{Money{-19999, "USD"}, "-199.99"},
+		{Money{0, ""}, "0.00"},
+		{Money{1500, "JPY"}, "1500"},
+		{Money{-1500, "JPY"}, "-1500"},
+		{Money{0, "JPY"}, "0"},
+		{Money{1234, "KWD"}, "1.234"},
+		{Money{1, "KWD"}, "0.001"},
+		{Money{-1, "KWD"}, "-0.001"},
+		{Money{math.MaxInt64, "RUB"}, "92233720368547758.07"},
+		{Money{math.MinInt64, "RUB"}, "-92233720368547758.08"},
+	}
+	for _, tc := range cases {
+		if got := tc.m.String(); got != tc.want { t.Errorf("%+v.String() = %q, want %q", tc.m, got, tc.want) }
+		if tc.m.Amount == math.MinInt64 { continue }
+		back, err := ParseMoney(tc.want, tc.m.Currency)
+		if err != nil || back.Amount != tc.m.Amount { t.Errorf("ParseMoney(%q) = %+v, %v, want %d", tc.want, back, err, tc.m.Amount) }
+	}
+}
+
+func TestMoneyAdd(t *testing.T) {
+	cases := []struct {
+		a, b     Money
+		want     int64
+		overflow bool
+	}{
+		{Money{19999, "RUB"}, Money{1, "RUB"}, 20000, false},
+		{Money{-5, "RUB"}, Money{3, "RUB"}, -2, false},
+		{Money{math.MaxInt64 - 1, "RUB"}, Money{1, "RUB"}, math.MaxInt64, false},
+		{Money{math.MaxInt64, "RUB"}, Money{1, "RUB"}, 0, true},
+		{Money{math.MinInt64, "RUB"}, Money{-1, "RUB"}, 0, true},
+		{Money{math.MinInt64, "RUB"}, Money{0, "RUB"}, math.MinInt64, false},
+	}
+	for _, tc := range cases {
+		got, err := tc.a.Add(tc.b)
+		if tc.overflow {
+			var e *Error
+			if !errors.As(err, &e) || e.Code != "amount_overflow" { t.Errorf("%+v.Add(%+v) error = %v, want amount_overflow", tc.a, tc.b, err) }
+			continue
+		}
+		if err != nil || got != (Money{tc.want, tc.a.Currency}) { t.Errorf("%+v.Add(%+v) = %+v, %v, want %d", tc.a, tc.b, got, err, tc.want) }
+	}
+	if _, err := (Money{1, "RUB"}).Add(Money{1, "USD"}); err == nil { t.Error("adding RUB and USD succeeded") }
+}
+
+func TestRoundMoney(t *testing.T) {
+	huge := new(big.Int).Lsh(big.NewInt(1), 63)
+	cases := []struct {
+		r        *big.Rat
+		want     int64
+		overflow bool
+	}{
+		{big.NewRat(5, 2), 3, false},
+		{big.NewRat(-5, 2), -3, false},
+		{big.NewRat(3, 2), 2, false},
+		{big.NewRat(1, 2), 1, false},
+		{big.NewRat(-1, 2), -1, false},
+		{big.NewRat(7, 3), 2, false},
+		{big.NewRat(-7, 3), -2, false},
+		{big.NewRat(8, 3), 3, false},
+		{big.NewRat(49, 100), 0, false},
+		{big.NewRat(0, 1), 0, false},
+		{big.NewRat(math.MaxInt64, 1), math.MaxInt64, false},
+		{new(big.Rat).SetInt(huge), 0, true},
+		{new(big.Rat).SetFrac(new(big.Int).Sub(new(big.Int).Mul(huge, big.NewInt(2)), big.NewInt(1)), big.NewInt(2)), 0, true},
+	}
+	for _, tc := range cases {
+		got, err := RoundMoney(tc.r, "USD")
+		if tc.overflow {
+			if err == nil { t.Errorf("RoundMoney(%s) = %+v, want overflow", tc.r, got) }
+			continue
+		}
+		if err != nil || got != (Money{tc.want, "USD"}) { t.Errorf("RoundMoney(%s) = %+v, %v, want %d", tc.r, got, err, tc.want) }
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	cases := []struct {
+		m    Money
+		want string
+	}{
+		{Money{19999, "RUB"}, `{"amount":"199.99","currency":"RUB"}`},
+		{Money{-1500, "JPY"}, `{"amount":"-1500","currency":"JPY"}`},
+		{Money{1000, "KWD"}, `{"amount":"1.000","currency":"KWD"}`},
+	}
+	for _, tc := range cases {
+		b, err := json.Marshal(tc.m)
+		if err != nil || string(b) != tc.want { t.Errorf("Marshal(%+v) = %s, %v, want %s", tc.m, b, err, tc.want) }
+		var back Money
+		if err := json.Unmarshal(b, &back); err != nil || back != tc.m { t.Errorf("Unmarshal(%s) = %+v, %v", b, back, err) }
+	}
+	var m Money
+	if err := json.Unmarshal([]byte(`{"amount":"1.5","currency":"JPY"}`), &m); !errors.Is(err, ErrMoneyPrecision) {
+		t.Errorf("Unmarshal of 1.5 JPY error = %v, want %v", err, ErrMoneyPrecision)
+	}
+}
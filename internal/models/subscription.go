@@ -5,13 +5,26 @@ import (
 	"time"
 )
 
+// Billing periods. A subscription charges its price once every BillingInterval periods.
+const (
+	BillingWeekly    = "weekly"
+	BillingMonthly   = "monthly"
+	BillingQuarterly = "quarterly"
+	BillingYearly    = "yearly"
+)
+
 type Subscription struct {
-	ID          uuid.UUID  `json:"id" db:"id"`
-	ServiceName string     `json:"service_name" db:"service_name"`
-	Price       int        `json:"price" db:"price"`
-	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
-	StartDate   time.Time  `json:"start_date" db:"start_date"`
-	EndDate     *time.Time `json:"end_date" db:"end_date"`
-	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	ID          uuid.UUID `json:"id" db:"id"`
+	ServiceName string    `json:"service_name" db:"service_name"`
+	// Price is charged once per billing cycle and carries the subscription's currency.
+	Price           Money      `json:"price" db:"price"`
+	UserID          uuid.UUID  `json:"user_id" db:"user_id"`
+	StartDate       time.Time  `json:"start_date" db:"start_date"`
+	EndDate         *time.Time `json:"end_date" db:"end_date"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+	Version         int64      `json:"version" db:"version"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	BillingPeriod   string     `json:"billing_period" db:"billing_period"`
+	BillingInterval int        `json:"billing_interval" db:"billing_interval"`
 }
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"subscription-service/internal/models"
+)
+
+// subscriptionsAt returns the relation to select subscriptions from: the live table, or with
+// asOf the row versions that were current at that instant, under the same name and columns.
+func subscriptionsAt(b *whereBuilder, asOf *time.Time) string {
+	if asOf == nil { return "subscriptions" }
+	t := b.arg(*asOf) + "::timestamptz"
+	return `(SELECT ` + subscriptionColumns + ` FROM subscription_versions
+		WHERE valid_from <= ` + t + ` AND (valid_to IS NULL OR valid_to > ` + t + `)) subscriptions`
+}
+
+// currentMonth is the first day of the month that counts as "now" for status filters.
+func currentMonth(b *whereBuilder, asOf *time.Time) string {
+	if asOf == nil { return "date_trunc('month', now())::date" }
+	return "date_trunc('month', " + b.arg(*asOf) + "::timestamptz)::date"
+}
+
+// GetAsOf returns the subscription as it was stored at asOf; it is not found if it did not exist
+// yet or was deleted at that time.
+func (r *SubscriptionRepository) GetAsOf(ctx context.Context, id uuid.UUID, asOf time.Time) (models.Subscription, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	b := whereBuilder{args: []any{id}}
+	q := `SELECT ` + subscriptionColumns + ` FROM ` + subscriptionsAt(&b, &asOf) + ` WHERE id = $1 AND deleted_at IS NULL`
+	s, err := scanSubscription(r.db.QueryRow(ctx, q, b.args...))
+	if err != nil { return s, mapError(ctx, "get subscription as of", err) }
+	return s, nil
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventCreated  = "created"
+	EventUpdated  = "updated"
+	EventDeleted  = "deleted"
+	EventRestored = "restored"
+	// EventPriceChanged records a price change in Event.PriceChange; its snapshots differ only in
+	// version and updated_at.
+	EventPriceChanged = "price_changed"
+)
+
+// Event is one entry of the append-only audit trail. Before and After are JSON snapshots of the
+// subscription; Before is empty for creations. PriceChange is the JSON of the change recorded by
+// a price_changed event and empty for all others.
+type Event struct {
+	ID             int64
+	SubscriptionID uuid.UUID
+	Type           string
+	Actor          string
+	RequestID      string
+	Before         []byte
+	After          []byte
+	PriceChange    []byte
+	OccurredAt     time.Time
+}
+
+// AppendEvent records e; call it on a transaction-bound repository so the event commits with the write.
+func (r *SubscriptionRepository) AppendEvent(ctx context.Context, e Event) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	const q = `INSERT INTO subscription_events (subscription_id, event_type, actor, request_id, before, after, price_change)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7)`
+	if _, err := r.db.Exec(ctx, q, e.SubscriptionID, e.Type, e.Actor, e.RequestID, e.Before, e.After, e.PriceChange); err != nil {
+		return mapError(ctx, "append subscription event", err)
+	}
+	return nil
+}
+
+// ListEvents returns the newest events of a subscription first, starting below beforeID when set.
+func (r *SubscriptionRepository) ListEvents(ctx context.Context, id uuid.UUID, beforeID *int64, limit int) (_ []Event, hasMore bool, _ error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	const q = `SELECT id, subscription_id, event_type, COALESCE(actor, ''), COALESCE(request_id, ''), before, after, price_change, occurred_at
+		FROM subscription_events WHERE subscription_id = $1 AND ($2::bigint IS NULL OR id < $2)
+		ORDER BY id DESC LIMIT $3`
+	rows, err := r.db.Query(ctx, q, id, beforeID, limit+1)
+	if err != nil { return nil, false, mapError(ctx, "list subscription events", err) }
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.SubscriptionID, &e.Type, &e.Actor, &e.RequestID, &e.Before, &e.After, &e.PriceChange, &e.OccurredAt); err != nil {
+			return nil, false, mapError(ctx, "scan subscription event", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil { return nil, false, mapError(ctx, "rows err", err) }
+	if len(events) > limit { return events[:limit], true, nil }
+	return events, false, nil
+}
+
+// Exists reports whether a subscription row exists, soft-deleted or not.
+func (r *SubscriptionRepository) Exists(ctx context.Context, id uuid.UUID) (bool, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	var exists bool
+	if err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM subscriptions WHERE id=$1)`, id).Scan(&exists); err != nil {
+		return false, mapError(ctx, "check subscription", err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IdempotencyRecord is what an earlier request stored under an Idempotency-Key.
+type IdempotencyRecord struct {
+	Fingerprint string
+	Response    []byte
+}
+
+// ClaimIdempotencyKey reserves key for the current transaction. It returns claimed=true when the
+// caller should perform the operation, or the live record left by an earlier request otherwise.
+// Expired keys are taken over. A concurrent claim of the same key blocks on the primary key until
+// the first transaction finishes, so only one of them ever performs the operation.
+func (r *SubscriptionRepository) ClaimIdempotencyKey(ctx context.Context, key, fingerprint string, ttl time.Duration) (_ IdempotencyRecord, claimed bool, _ error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	const claim = `INSERT INTO idempotency_keys (key, fingerprint, expires_at) VALUES ($1, $2, now() + $3::bigint * interval '1 millisecond')
+		ON CONFLICT (key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, response = NULL, created_at = now(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= now()
+		RETURNING true`
+	err := r.db.QueryRow(ctx, claim, key, fingerprint, ttl.Milliseconds()).Scan(&claimed)
+	if err == nil { return IdempotencyRecord{}, true, nil }
+	if !errors.Is(err, pgx.ErrNoRows) { return IdempotencyRecord{}, false, mapError(ctx, "claim idempotency key", err) }
+
+	var rec IdempotencyRecord
+	const get = `SELECT fingerprint, response FROM idempotency_keys WHERE key = $1`
+	if err := r.db.QueryRow(ctx, get, key).Scan(&rec.Fingerprint, &rec.Response); err != nil {
+		return IdempotencyRecord{}, false, mapError(ctx, "get idempotency key", err)
+	}
+	return rec, false, nil
+}
+
+// CompleteIdempotencyKey stores the response to replay for later requests with the same key.
+func (r *SubscriptionRepository) CompleteIdempotencyKey(ctx context.Context, key string, response []byte) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	if _, err := r.db.Exec(ctx, `UPDATE idempotency_keys SET response = $2 WHERE key = $1`, key, response); err != nil {
+		return mapError(ctx, "complete idempotency key", err)
+	}
+	return nil
+}
+
+// PurgeExpiredIdempotencyKeys deletes keys past their TTL and reports how many were removed.
+func (r *SubscriptionRepository) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	ct, err := r.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= now()`)
+	if err != nil { return 0, mapError(ctx, "purge idempotency keys", err) }
+	return ct.RowsAffected(), nil
+}
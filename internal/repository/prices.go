@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"subscription-service/internal/models"
+)
+
+// PriceChange sets the price of a subscription from EffectiveFrom (a first of month) on.
+type PriceChange struct {
+	SubscriptionID uuid.UUID
+	EffectiveFrom  time.Time
+	// Price is in minor units of the subscription's currency.
+	Price          int64
+	CreatedAt      time.Time
+}
+
+// chargedSegments returns the relation that totals are computed over: one row per stretch of a
+// subscription with a constant price, carrying the subscription columns with start_date,
+// end_date and price narrowed to that stretch. billing_anchor keeps the original start_date that
+// charges are scheduled from. A subscription without price changes is a single segment.
+func chargedSegments(b *whereBuilder, asOf *time.Time) string {
+	src := subscriptionsAt(b, asOf)
+	seen := ""
+	if asOf != nil { seen = " AND c.created_at <= " + b.arg(*asOf) + "::timestamptz" }
+	return `(SELECT * FROM (
+		SELECT s.id, s.service_name, tl.price, s.currency, s.user_id, tl.seg_start AS start_date,
+			s.start_date AS billing_anchor, s.billing_period, s.billing_interval,
+			CASE WHEN tl.seg_next IS NULL THEN s.end_date
+				ELSE LEAST(COALESCE(s.end_date, 'infinity'::date), (tl.seg_next - interval '1 month')::date) END AS end_date,
+			s.deleted_at
+		FROM (SELECT * FROM ` + src + `) s
+		CROSS JOIN LATERAL (
+			SELECT price, seg_start, lead(seg_start) OVER (ORDER BY seg_start) AS seg_next FROM (
+				SELECT s.price, s.start_date AS seg_start
+				UNION ALL
+				SELECT c.price, c.effective_from FROM subscription_prices c
+				WHERE c.subscription_id = s.id AND c.effective_from > s.start_date` + seen + `
+			) points
+		) tl
+	) seg WHERE end_date IS NULL OR start_date <= end_date) subscriptions`
+}
+
+// AddPriceChange records a new price from p.EffectiveFrom; a change for the same month already
+// existing is a conflict.
+func (r *SubscriptionRepository) AddPriceChange(ctx context.Context, p PriceChange) (PriceChange, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	const q = `INSERT INTO subscription_prices (subscription_id, effective_from, price) VALUES ($1, $2, $3)
+		ON CONFLICT (subscription_id, effective_from) DO NOTHING RETURNING created_at`
+	err := r.db.QueryRow(ctx, q, p.SubscriptionID, p.EffectiveFrom, p.Price).Scan(&p.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, models.Conflict("price_change_exists", "a price change for this month already exists", nil)
+	}
+	if err != nil { return p, mapError(ctx, "add price change", err) }
+	return p, nil
+}
+
+// ListPriceChanges returns the price changes of a subscription in effective order.
+func (r *SubscriptionRepository) ListPriceChanges(ctx context.Context, id uuid.UUID) ([]PriceChange, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	const q = `SELECT subscription_id, effective_from, price, created_at FROM subscription_prices
+		WHERE subscription_id = $1 ORDER BY effective_from`
+	rows, err := r.db.Query(ctx, q, id)
+	if err != nil { return nil, mapError(ctx, "list price changes", err) }
+	defer rows.Close()
+
+	var items []PriceChange
+	for rows.Next() {
+		var p PriceChange
+		if err := rows.Scan(&p.SubscriptionID, &p.EffectiveFrom, &p.Price, &p.CreatedAt); err != nil {
+			return nil, mapError(ctx, "scan price change", err)
+		}
+		items = append(items, p)
+	}
+	if err := rows.Err(); err != nil { return nil, mapError(ctx, "rows err", err) }
+	return items, nil
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// ExchangeRate is a reference rate in the ECB convention: Rate units of Currency buy one euro.
+// Rate is kept as decimal text so no precision is lost between the file and NUMERIC.
+type ExchangeRate struct {
+	Currency string
+	Date     time.Time
+	Rate     string
+}
+
+// AddExchangeRates stores rates as loaded now. Rates already known for the same currency and day
+// are kept, so RatesForMonths can still answer with them for an earlier instant.
+func (r *SubscriptionRepository) AddExchangeRates(ctx context.Context, rates []ExchangeRate) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Aggregate)
+	defer cancel()
+	currencies := make([]string, len(rates))
+	dates := make([]time.Time, len(rates))
+	values := make([]string, len(rates))
+	for i, rt := range rates {
+		currencies[i], dates[i], values[i] = rt.Currency, rt.Date, rt.Rate
+	}
+	const q = `INSERT INTO exchange_rates (currency, rate_date, rate)
+		SELECT * FROM unnest($1::text[], $2::date[], $3::text[]::numeric[])`
+	ct, err := r.db.Exec(ctx, q, currencies, dates, values)
+	if err != nil { return 0, mapError(ctx, "add exchange rates", err) }
+	return ct.RowsAffected(), nil
+}
+
+// MonthlyCharge is what the subscriptions matching a total charge in one month and currency.
+type MonthlyCharge struct {
+	Month    time.Time
+	Currency string
+	Amount   int64
+}
+
+// MonthlyCharges splits SumOverlapMonths by month and currency, the granularity at which
+// amounts are converted. Months without a charge are left out, so they need no rate.
+func (r *SubscriptionRepository) MonthlyCharges(ctx context.Context, f TotalFilters) ([]MonthlyCharge, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Aggregate)
+	defer cancel()
+	src, args := overlapQuery(f)
+	q := `SELECT month, currency, SUM(amount)::bigint FROM (
+			SELECT g.m::date AS month, t.currency,
+				charged_between(t.price, t.billing_anchor, t.billing_period, t.billing_interval, g.m::date, g.m::date, $3::boolean) AS amount
+			FROM (` + src + `) t
+			CROSS JOIN LATERAL generate_series(date_trunc('month', t.clip_start), date_trunc('month', t.clip_end), interval '1 month') AS g(m)
+		) c WHERE amount > 0 GROUP BY 1, 2 ORDER BY 1, 2`
+	rows, err := r.db.Query(ctx, q, args...)
+	if err != nil { return nil, mapError(ctx, "monthly charges", err) }
+	defer rows.Close()
+
+	var items []MonthlyCharge
+	for rows.Next() {
+		var c MonthlyCharge
+		if err := rows.Scan(&c.Month, &c.Currency, &c.Amount); err != nil { return nil, mapError(ctx, "scan monthly charge", err) }
+		items = append(items, c)
+	}
+	if err := rows.Err(); err != nil { return nil, mapError(ctx, "rows err", err) }
+	return items, nil
+}
+
+// MonthRate is the rate of a currency for a month: the latest one published up to the month's
+// end. Date and Rate are nil when no rate is known yet.
+type MonthRate struct {
+	Month    time.Time
+	Currency string
+	Date     *time.Time
+	Rate     *string
+}
+
+// RatesForMonths looks up the rate of every currency for every month, as most recently loaded, or
+// as loaded by asOf when it is set.
+func (r *SubscriptionRepository) RatesForMonths(ctx context.Context, months []time.Time, currencies []string, asOf *time.Time) ([]MonthRate, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	const q = `SELECT mo.m, c.cur, er.rate_date, er.rate::text
+		FROM unnest($1::date[]) AS mo(m)
+		CROSS JOIN unnest($2::text[]) AS c(cur)
+		LEFT JOIN LATERAL (
+			SELECT rate, rate_date FROM exchange_rates
+			WHERE currency = c.cur AND rate_date < mo.m + interval '1 month'
+				AND ($3::timestamptz IS NULL OR loaded_at <= $3)
+			ORDER BY rate_date DESC, loaded_at DESC LIMIT 1
+		) er ON true`
+	rows, err := r.db.Query(ctx, q, months, currencies, asOf)
+	if err != nil { return nil, mapError(ctx, "rates for months", err) }
+	defer rows.Close()
+
+	var items []MonthRate
+	for rows.Next() {
+		var m MonthRate
+		if err := rows.Scan(&m.Month, &m.Currency, &m.Date, &m.Rate); err != nil { return nil, mapError(ctx, "scan month rate", err) }
+		items = append(items, m)
+	}
+	if err := rows.Err(); err != nil { return nil, mapError(ctx, "rows err", err) }
+	return items, nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"strings"
+)
+
+// addSearch keeps rows whose service name is word-similar (pg_trgm <%) to any of the terms and
+// returns the relevance expression used to rank them.
+func addSearch(b *whereBuilder, terms []string) string {
+	conds := make([]string, len(terms))
+	args := make([]any, len(terms))
+	for i, t := range terms {
+		conds[i] = "$%d <%% service_name"
+		args[i] = t
+	}
+	b.add("("+strings.Join(conds, " OR ")+")", args...)
+	return relevance(b, terms)
+}
+
+func relevance(b *whereBuilder, terms []string) string {
+	scores := make([]string, len(terms))
+	for i, t := range terms { scores[i] = "word_similarity(" + b.arg(t) + ", service_name)" }
+	return "GREATEST(" + strings.Join(scores, ", ") + ")"
+}
+
+type ServiceNameSuggestion struct {
+	ServiceName   string
+	Subscriptions int
+	Score         float64
+}
+
+// SuggestServiceNames returns distinct service names that start with prefix (case-insensitively)
+// or are trigram-similar to any of terms; prefix matches rank first, then by similarity.
+func (r *SubscriptionRepository) SuggestServiceNames(ctx context.Context, prefix string, terms []string, limit int) ([]ServiceNameSuggestion, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	var b whereBuilder
+	like := b.arg(likeEscaper.Replace(strings.ToLower(prefix)) + "%")
+	conds := []string{`lower(service_name) LIKE ` + like + ` ESCAPE '\'`}
+	for _, t := range terms { conds = append(conds, b.arg(t)+" <% service_name") }
+	score := relevance(&b, terms)
+	q := `SELECT service_name, count(1), ` + score + `
+		FROM subscriptions WHERE deleted_at IS NULL AND (` + strings.Join(conds, " OR ") + `)
+		GROUP BY service_name
+		ORDER BY lower(service_name) LIKE ` + like + ` ESCAPE '\' DESC, 3 DESC, service_name
+		LIMIT ` + b.arg(limit)
+
+	rows, err := r.db.Query(ctx, q, b.args...)
+	if err != nil { return nil, mapError(ctx, "suggest service names", err) }
+	defer rows.Close()
+
+	var items []ServiceNameSuggestion
+	for rows.Next() {
+		var s ServiceNameSuggestion
+		if err := rows.Scan(&s.ServiceName, &s.Subscriptions, &s.Score); err != nil {
+			return nil, mapError(ctx, "scan suggestion", err)
+		}
+		items = append(items, s)
+	}
+	if err := rows.Err(); err != nil { return nil, mapError(ctx, "rows err", err) }
+	return items, nil
+}
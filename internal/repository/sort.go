@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"subscription-service/internal/models"
+)
+
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// sortColumn describes a client-sortable column. Only fields listed in sortColumns ever reach SQL,
+// and cursor values travel as text that is cast back with typ.
+type sortColumn struct {
+	expr  string
+	typ   string
+	value func(models.Subscription) string
+}
+
+var sortColumns = map[string]sortColumn{
+	"price":        {expr: "price", typ: "bigint", value: func(s models.Subscription) string { return strconv.FormatInt(s.Price.Amount, 10) }},
+	"start_date":   {expr: "start_date", typ: "date", value: func(s models.Subscription) string { return s.StartDate.Format(time.DateOnly) }},
+	"end_date":     {expr: "COALESCE(end_date, 'infinity'::date)", typ: "date", value: endDateValue},
+	"service_name": {expr: "service_name", typ: "text", value: func(s models.Subscription) string { return s.ServiceName }},
+	"created_at":   {expr: "created_at", typ: "timestamptz", value: func(s models.Subscription) string { return s.CreatedAt.Format(time.RFC3339Nano) }},
+	"updated_at":   {expr: "updated_at", typ: "timestamptz", value: func(s models.Subscription) string { return s.UpdatedAt.Format(time.RFC3339Nano) }},
+}
+
+// Open-ended subscriptions sort as if they ended at infinity, which keeps keyset comparisons NULL-free.
+func endDateValue(s models.Subscription) string {
+	if s.EndDate == nil { return "infinity" }
+	return s.EndDate.Format(time.DateOnly)
+}
+
+var DefaultSort = []SortKey{{Field: "created_at", Desc: true}}
+
+func SortFields() []string {
+	fields := make([]string, 0, len(sortColumns))
+	for f := range sortColumns { fields = append(fields, f) }
+	slices.Sort(fields)
+	return fields
+}
+
+func IsSortField(field string) bool {
+	_, ok := sortColumns[field]
+	return ok
+}
+
+// IsSortValue reports whether value, which comes back from the client in a cursor, casts to the
+// type of field's column, so that a tampered cursor is rejected before Postgres fails on it.
+func IsSortValue(field, value string) bool {
+	var t time.Time
+	var err error
+	switch sortColumns[field].typ {
+	case "bigint":
+		_, err = strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case "text":
+		return utf8.ValidString(value) && !strings.ContainsRune(value, 0)
+	case "date":
+		if value == "infinity" { return true }
+		t, err = time.Parse(time.DateOnly, value)
+	case "timestamptz":
+		t, err = time.Parse(time.RFC3339Nano, value)
+	default:
+		return false
+	}
+	// Postgres has no year 0, which Go would parse.
+	return err == nil && t.Year() >= 1
+}
+
+// CursorAt returns the keyset position of s under the given sort order.
+func CursorAt(keys []SortKey, s models.Subscription, backward bool) Cursor {
+	c := Cursor{ID: s.ID, Backward: backward}
+	for _, k := range keys { c.Values = append(c.Values, sortColumns[k.Field].value(s)) }
+	return c
+}
+
+// orderBy renders the ORDER BY clause; id breaks ties in the direction of the last key.
+// Walking backwards reverses every direction.
+func orderBy(keys []SortKey, backward bool) string {
+	parts := make([]string, 0, len(keys)+1)
+	dir := func(desc bool) string {
+		if desc != backward { return "DESC" }
+		return "ASC"
+	}
+	for _, k := range keys { parts = append(parts, sortColumns[k.Field].expr+" "+dir(k.Desc)) }
+	parts = append(parts, "id "+dir(keys[len(keys)-1].Desc))
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// addKeyset restricts b to rows strictly after c in the given order.
+func addKeyset(b *whereBuilder, keys []SortKey, c Cursor) {
+	exprs := make([]string, 0, len(keys)+1)
+	descs := make([]bool, 0, len(keys)+1)
+	args := make([]any, 0, len(keys)+1)
+	for i, k := range keys {
+		col := sortColumns[k.Field]
+		exprs = append(exprs, fmt.Sprintf("$%%d::text::%s", col.typ))
+		descs = append(descs, k.Desc)
+		args = append(args, c.Values[i])
+	}
+	exprs = append(exprs, "$%d::uuid")
+	descs = append(descs, keys[len(keys)-1].Desc)
+	args = append(args, c.ID)
+
+	cols := make([]string, 0, len(keys)+1)
+	for _, k := range keys { cols = append(cols, sortColumns[k.Field].expr) }
+	cols = append(cols, "id")
+	op := func(desc bool) string {
+		if desc != c.Backward { return "<" }
+		return ">"
+	}
+
+	// A single direction allows a row comparison, which Postgres can serve from an index.
+	if !slices.Contains(descs, !descs[0]) {
+		b.add("("+strings.Join(cols, ", ")+") "+op(descs[0])+" ("+strings.Join(exprs, ", ")+")", args...)
+		return
+	}
+	var ors []string
+	var orArgs []any
+	for i := range cols {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, cols[j]+" = "+exprs[j])
+			orArgs = append(orArgs, args[j])
+		}
+		ands = append(ands, cols[i]+" "+op(descs[i])+" "+exprs[i])
+		orArgs = append(orArgs, args[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	b.add("("+strings.Join(ors, " OR ")+")", orArgs...)
+}
+
+// SortSignature is the canonical text form of keys, e.g. "price:desc,service_name:asc".
+func SortSignature(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.Field + ":asc"
+		if k.Desc { parts[i] = k.Field + ":desc" }
+	}
+	return strings.Join(parts, ",")
+}
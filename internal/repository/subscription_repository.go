@@ -2,103 +2,523 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"subscription-service/internal/logger"
 	"subscription-service/internal/models"
 )
 
 type SubscriptionRepository struct {
-	pool *pgxpool.Pool
+	pool     *pgxpool.Pool
+	db       dbtx
+	timeouts Timeouts
 }
 
-func NewSubscriptionRepository(pool *pgxpool.Pool) *SubscriptionRepository {
-	return &SubscriptionRepository{pool: pool}
+// dbtx is what both the pool and a transaction offer, so the same queries run inside InTx.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Timeouts bound how long a single statement may run per kind of operation; zero means no limit.
+type Timeouts struct {
+	Read      time.Duration
+	Write     time.Duration
+	Aggregate time.Duration
+}
+
+func NewSubscriptionRepository(pool *pgxpool.Pool, timeouts Timeouts) *SubscriptionRepository {
+	return &SubscriptionRepository{pool: pool, db: pool, timeouts: timeouts}
+}
+
+// InTx runs fn against a repository bound to a single transaction, committing if fn succeeds.
+// Called on a repository that is already inside a transaction it simply reuses it.
+func (r *SubscriptionRepository) InTx(ctx context.Context, fn func(tx *SubscriptionRepository) error) error {
+	if _, ok := r.db.(pgx.Tx); ok { return fn(r) }
+	tx, err := r.pool.Begin(ctx)
+	if err != nil { return mapError(ctx, "begin transaction", err) }
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+	if err := fn(&SubscriptionRepository{pool: r.pool, db: tx, timeouts: r.timeouts}); err != nil { return err }
+	if err := tx.Commit(ctx); err != nil { return mapError(ctx, "commit transaction", err) }
+	return nil
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 { return context.WithCancel(ctx) }
+	return context.WithTimeout(ctx, d)
+}
+
+const (
+	pgUniqueViolation = "23505"
+	pgCheckViolation  = "23514"
+	pgQueryCanceled   = "57014"
+	pgNumericRange    = "22003"
+)
+
+// mapError translates pgx errors into domain errors; anything unexpected becomes models.ErrInternal.
+func mapError(ctx context.Context, op string, err error) error {
+	if errors.Is(err, pgx.ErrNoRows) { return models.NotFound("subscription_not_found", "subscription not found") }
+	log := logger.FromContext(ctx).With(zap.String("op", op))
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Warn("statement timed out", zap.Error(err))
+		return models.Timeout(op, err)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		log.Debug("statement failed", zap.String("sqlstate", pgErr.Code), zap.Error(err))
+		switch pgErr.Code {
+		case pgQueryCanceled:
+			return models.Timeout(op, err)
+		case pgUniqueViolation:
+			return models.Conflict("subscription_conflict", "subscription already exists", err)
+		case pgCheckViolation:
+			return models.Validation("constraint_violation", fmt.Sprintf("%s: %s", op, pgErr.ConstraintName))
+		case pgNumericRange:
+			return models.AmountOverflow()
+		}
+	}
+	return models.Internal(op, err)
+}
+
+const subscriptionColumns = `id, service_name, price, user_id, start_date, end_date, created_at, updated_at, version, deleted_at, currency, billing_period, billing_interval`
+
+func scanSubscription(row pgx.Row) (models.Subscription, error) {
+	var s models.Subscription
+	err := row.Scan(&s.ID, &s.ServiceName, &s.Price.Amount, &s.UserID, &s.StartDate, &s.EndDate, &s.CreatedAt, &s.UpdatedAt, &s.Version, &s.DeletedAt, &s.Price.Currency, &s.BillingPeriod, &s.BillingInterval)
+	return s, err
 }
 
 func (r *SubscriptionRepository) Create(ctx context.Context, s models.Subscription) (models.Subscription, error) {
-	const q = `INSERT INTO subscriptions (id, service_name, price, user_id, start_date, end_date, created_at, updated_at)
-		VALUES ($1,$2,$3,$4,$5,$6,now(),now()) RETURNING created_at, updated_at`
-	row := r.pool.QueryRow(ctx, q, s.ID, s.ServiceName, s.Price, s.UserID, s.StartDate, s.EndDate)
-	if err := row.Scan(&s.CreatedAt, &s.UpdatedAt); err != nil {
-		return s, fmt.Errorf("insert subscription: %w", err)
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	const q = `INSERT INTO subscriptions (id, service_name, price, user_id, start_date, end_date, currency, billing_period, billing_interval, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,now(),now()) RETURNING created_at, updated_at, version`
+	row := r.db.QueryRow(ctx, q, s.ID, s.ServiceName, s.Price.Amount, s.UserID, s.StartDate, s.EndDate, s.Price.Currency, s.BillingPeriod, s.BillingInterval)
+	if err := row.Scan(&s.CreatedAt, &s.UpdatedAt, &s.Version); err != nil {
+		return s, mapError(ctx, "insert subscription", err)
 	}
 	return s, nil
 }
 
 func (r *SubscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (models.Subscription, error) {
-	const q = `SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at FROM subscriptions WHERE id = $1`
-	row := r.pool.QueryRow(ctx, q, id)
-	var s models.Subscription
-	if err := row.Scan(&s.ID, &s.ServiceName, &s.Price, &s.UserID, &s.StartDate, &s.EndDate, &s.CreatedAt, &s.UpdatedAt); err != nil {
-		if err == pgx.ErrNoRows { return s, fmt.Errorf("not found") }
-		return s, fmt.Errorf("get subscription: %w", err)
-	}
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	const q = `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`
+	s, err := scanSubscription(r.db.QueryRow(ctx, q, id))
+	if err != nil { return s, mapError(ctx, "get subscription", err) }
 	return s, nil
 }
 
+// Update writes s only if the stored row still has s.Version and bumps the version, so a
+// concurrent writer between our read and this write is reported instead of overwritten.
 func (r *SubscriptionRepository) Update(ctx context.Context, s models.Subscription) (models.Subscription, error) {
-	const q = `UPDATE subscriptions SET service_name=$2, price=$3, user_id=$4, start_date=$5, end_date=$6, updated_at=now() WHERE id=$1 RETURNING created_at, updated_at`
-	row := r.pool.QueryRow(ctx, q, s.ID, s.ServiceName, s.Price, s.UserID, s.StartDate, s.EndDate)
-	if err := row.Scan(&s.CreatedAt, &s.UpdatedAt); err != nil {
-		return s, fmt.Errorf("update subscription: %w", err)
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	const q = `UPDATE subscriptions SET service_name=$2, price=$3, user_id=$4, start_date=$5, end_date=$6, currency=$8,
+		billing_period=$9, billing_interval=$10, updated_at=now(), version=version+1
+		WHERE id=$1 AND version=$7 AND deleted_at IS NULL RETURNING created_at, updated_at, version`
+	row := r.db.QueryRow(ctx, q, s.ID, s.ServiceName, s.Price.Amount, s.UserID, s.StartDate, s.EndDate, s.Version, s.Price.Currency, s.BillingPeriod, s.BillingInterval)
+	if err := row.Scan(&s.CreatedAt, &s.UpdatedAt, &s.Version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) { return s, r.versionMismatch(ctx, s.ID) }
+		return s, mapError(ctx, "update subscription", err)
 	}
 	return s, nil
 }
 
-func (r *SubscriptionRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	const q = `DELETE FROM subscriptions WHERE id=$1`
-	ct, err := r.pool.Exec(ctx, q, id)
-	if err != nil { return fmt.Errorf("delete subscription: %w", err) }
-	if ct.RowsAffected() == 0 { return fmt.Errorf("not found") }
-	return nil
+// Delete soft-deletes the row by stamping deleted_at and returns it; with a non-nil version only
+// if the row is still at that version. The row stays restorable until PurgeDeleted removes it.
+func (r *SubscriptionRepository) Delete(ctx context.Context, id uuid.UUID, version *int64) (models.Subscription, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	const q = `UPDATE subscriptions SET deleted_at=now(), updated_at=now(), version=version+1
+		WHERE id=$1 AND deleted_at IS NULL AND ($2::bigint IS NULL OR version=$2)
+		RETURNING ` + subscriptionColumns
+	s, err := scanSubscription(r.db.QueryRow(ctx, q, id, version))
+	if errors.Is(err, pgx.ErrNoRows) && version != nil { return s, r.versionMismatch(ctx, id) }
+	if err != nil { return s, mapError(ctx, "delete subscription", err) }
+	return s, nil
+}
+
+// Restore clears deleted_at of a soft-deleted row and returns it.
+func (r *SubscriptionRepository) Restore(ctx context.Context, id uuid.UUID, version *int64) (models.Subscription, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	const q = `UPDATE subscriptions SET deleted_at=NULL, updated_at=now(), version=version+1
+		WHERE id=$1 AND deleted_at IS NOT NULL AND ($2::bigint IS NULL OR version=$2)
+		RETURNING ` + subscriptionColumns
+	s, err := scanSubscription(r.db.QueryRow(ctx, q, id, version))
+	if err == nil { return s, nil }
+	if !errors.Is(err, pgx.ErrNoRows) { return s, mapError(ctx, "restore subscription", err) }
+
+	var deleted bool
+	if err := r.db.QueryRow(ctx, `SELECT deleted_at IS NOT NULL FROM subscriptions WHERE id=$1`, id).Scan(&deleted); err != nil {
+		return s, mapError(ctx, "check subscription", err)
+	}
+	if !deleted { return s, models.Conflict("subscription_not_deleted", "subscription is not deleted", nil) }
+	return s, models.PreconditionFailed("version_mismatch", "subscription was modified by another request")
+}
+
+// GetIncludingDeleted returns a row whether or not it is soft-deleted; GetByID only sees live ones.
+func (r *SubscriptionRepository) GetIncludingDeleted(ctx context.Context, id uuid.UUID) (models.Subscription, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	const q = `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE id = $1`
+	s, err := scanSubscription(r.db.QueryRow(ctx, q, id))
+	if err != nil { return s, mapError(ctx, "get subscription including deleted", err) }
+	return s, nil
+}
+
+// PurgeDeleted hard-deletes rows that were soft-deleted longer than retention ago. Their row
+// versions and price changes stay, so as-of reads and totals before the deletion are unchanged.
+func (r *SubscriptionRepository) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	const q = `DELETE FROM subscriptions WHERE deleted_at < now() - $1::bigint * interval '1 millisecond'`
+	ct, err := r.db.Exec(ctx, q, retention.Milliseconds())
+	if err != nil { return 0, mapError(ctx, "purge deleted subscriptions", err) }
+	return ct.RowsAffected(), nil
 }
 
+// versionMismatch explains why a versioned write matched no row: either it is gone or it changed.
+func (r *SubscriptionRepository) versionMismatch(ctx context.Context, id uuid.UUID) error {
+	var exists bool
+	if err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM subscriptions WHERE id=$1 AND deleted_at IS NULL)`, id).Scan(&exists); err != nil {
+		return mapError(ctx, "check subscription version", err)
+	}
+	if !exists { return models.NotFound("subscription_not_found", "subscription not found") }
+	return models.PreconditionFailed("version_mismatch", "subscription was modified by another request")
+}
+
+const (
+	StatusActive = "active"
+	StatusEnded  = "ended"
+)
+
+// Deleted modes for ListFilters; the zero value hides soft-deleted rows.
+const (
+	DeletedInclude = "include"
+	DeletedOnly    = "only"
+)
+
 type ListFilters struct {
-	UserID      *uuid.UUID
-	ServiceName *string
-	From        *time.Time
-	To          *time.Time
-	Limit       int
-	Offset      int
-}
-
-func (r *SubscriptionRepository) List(ctx context.Context, f ListFilters) ([]models.Subscription, int, error) {
-	base := `SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at FROM subscriptions WHERE 1=1`
-	countBase := `SELECT count(1) FROM subscriptions WHERE 1=1`
-	args := []any{}
-	idx := 1
-
-	if f.UserID != nil { base += fmt.Sprintf(" AND user_id = $%d", idx); countBase += fmt.Sprintf(" AND user_id = $%d", idx); args = append(args, *f.UserID); idx++ }
-	if f.ServiceName != nil { base += fmt.Sprintf(" AND service_name = $%d", idx); countBase += fmt.Sprintf(" AND service_name = $%d", idx); args = append(args, *f.ServiceName); idx++ }
-	if f.From != nil { base += fmt.Sprintf(" AND (end_date IS NULL OR end_date >= $%d)", idx); countBase += fmt.Sprintf(" AND (end_date IS NULL OR end_date >= $%d)", idx); args = append(args, *f.From); idx++ }
-	if f.To != nil { base += fmt.Sprintf(" AND start_date <= $%d", idx); countBase += fmt.Sprintf(" AND start_date <= $%d", idx); args = append(args, *f.To); idx++ }
-
-	base += " ORDER BY created_at DESC"
-	base += fmt.Sprintf(" LIMIT %d OFFSET %d", f.Limit, f.Offset)
-
-	rows, err := r.pool.Query(ctx, base, args...)
-	if err != nil { return nil, 0, fmt.Errorf("list subscriptions: %w", err) }
+	UserIDs           []uuid.UUID
+	ServiceNames      []string
+	ServiceNamePrefix *string
+	From              *time.Time
+	To                *time.Time
+	PriceMin          *int
+	PriceMax          *int
+	ActiveAt          *time.Time
+	Status            string
+	HasEndDate        *bool
+	CreatedAfter      *time.Time
+	CreatedBefore     *time.Time
+	// SearchTerms enables fuzzy service name search; results are ranked by relevance first.
+	SearchTerms       []string
+	Deleted           string
+	// AsOf lists the subscriptions as they were stored at that instant instead of now.
+	AsOf              *time.Time
+	Limit             int
+	Offset            int
+	Sort              []SortKey
+	After             *Cursor
+}
+
+// Cursor is a keyset position: the sort key values of a row, rendered as text, plus its id.
+// Backward cursors page towards the start of the order.
+type Cursor struct {
+	Values   []string
+	ID       uuid.UUID
+	Backward bool
+}
+
+type ListResult struct {
+	Items []models.Subscription
+	Total int
+	// HasMore reports whether rows exist past this page in the direction of travel.
+	HasMore bool
+}
+
+type whereBuilder struct {
+	conds []string
+	args  []any
+}
+
+// add appends a condition whose %d verbs are replaced with the placeholder indexes of args in order.
+func (b *whereBuilder) add(cond string, args ...any) {
+	idx := make([]any, len(args))
+	for i, arg := range args {
+		b.args = append(b.args, arg)
+		idx[i] = len(b.args)
+	}
+	b.conds = append(b.conds, fmt.Sprintf(cond, idx...))
+}
+
+// arg registers a value without a condition and returns its placeholder, for use outside WHERE.
+func (b *whereBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *whereBuilder) sql() string {
+	if len(b.conds) == 0 { return "" }
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
+
+func applyFilters(b *whereBuilder, userID *uuid.UUID, serviceName *string, from, to *time.Time) {
+	if userID != nil { b.add("user_id = $%d", *userID) }
+	if serviceName != nil { b.add("service_name = $%d", *serviceName) }
+	if from != nil { b.add("(end_date IS NULL OR end_date >= $%d)", *from) }
+	if to != nil { b.add("start_date <= $%d", *to) }
+}
+
+// likeEscaper escapes LIKE wildcards so user input only ever matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func applyListFilters(b *whereBuilder, f ListFilters) {
+	applyFilters(b, nil, nil, f.From, f.To)
+	if len(f.UserIDs) > 0 { b.add("user_id = ANY($%d)", f.UserIDs) }
+	if len(f.ServiceNames) > 0 { b.add("service_name = ANY($%d)", f.ServiceNames) }
+	if f.ServiceNamePrefix != nil {
+		b.add(`lower(service_name) LIKE $%d ESCAPE '\'`, likeEscaper.Replace(strings.ToLower(*f.ServiceNamePrefix))+"%")
+	}
+	// Price bounds are whole units of each subscription's own currency; prices are stored in minor units.
+	if f.PriceMin != nil { b.add("price >= $%d::bigint * (10 ^ currency_exponent(currency))::bigint", *f.PriceMin) }
+	if f.PriceMax != nil { b.add("price <= $%d::bigint * (10 ^ currency_exponent(currency))::bigint", *f.PriceMax) }
+	if f.ActiveAt != nil { b.add("start_date <= $%d AND (end_date IS NULL OR end_date >= $%d)", *f.ActiveAt, *f.ActiveAt) }
+	// Status is relative to the current month, or to the month of AsOf when looking back.
+	switch f.Status {
+	case StatusActive:
+		month := currentMonth(b, f.AsOf)
+		b.add("start_date <= " + month + " AND (end_date IS NULL OR end_date >= " + month + ")")
+	case StatusEnded:
+		b.add("end_date < " + currentMonth(b, f.AsOf))
+	}
+	if f.HasEndDate != nil && *f.HasEndDate { b.add("end_date IS NOT NULL") }
+	if f.HasEndDate != nil && !*f.HasEndDate { b.add("end_date IS NULL") }
+	if f.CreatedAfter != nil { b.add("created_at > $%d", *f.CreatedAfter) }
+	if f.CreatedBefore != nil { b.add("created_at < $%d", *f.CreatedBefore) }
+	switch f.Deleted {
+	case DeletedInclude:
+	case DeletedOnly:
+		b.add("deleted_at IS NOT NULL")
+	default:
+		b.add("deleted_at IS NULL")
+	}
+}
+
+func (r *SubscriptionRepository) List(ctx context.Context, f ListFilters) (ListResult, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	var b whereBuilder
+	src := subscriptionsAt(&b, f.AsOf)
+	applyListFilters(&b, f)
+	var score string
+	if len(f.SearchTerms) > 0 { score = addSearch(&b, f.SearchTerms) }
+	countBase := `SELECT count(1) FROM ` + src + b.sql()
+	countArgs := append([]any(nil), b.args[:len(b.args)-len(f.SearchTerms)]...)
+
+	keys := f.Sort
+	if len(keys) == 0 { keys = DefaultSort }
+	order := orderBy(keys, false)
+	if score != "" { order = " ORDER BY " + score + " DESC, " + strings.TrimPrefix(order, " ORDER BY ") }
+	offset := f.Offset
+	if f.After != nil {
+		addKeyset(&b, keys, *f.After)
+		order = orderBy(keys, f.After.Backward)
+		offset = 0
+	}
+	base := `SELECT ` + subscriptionColumns + ` FROM ` + src + b.sql()
+	base += order
+	base += fmt.Sprintf(" LIMIT %d OFFSET %d", f.Limit+1, offset)
+
+	rows, err := r.db.Query(ctx, base, b.args...)
+	if err != nil { return ListResult{}, mapError(ctx, "list subscriptions", err) }
 	defer rows.Close()
 
-	var items []models.Subscription
+	var res ListResult
 	for rows.Next() {
-		var s models.Subscription
-		if err := rows.Scan(&s.ID, &s.ServiceName, &s.Price, &s.UserID, &s.StartDate, &s.EndDate, &s.CreatedAt, &s.UpdatedAt); err != nil {
-			return nil, 0, fmt.Errorf("scan subscription: %w", err)
+		s, err := scanSubscription(rows)
+		if err != nil { return ListResult{}, mapError(ctx, "scan subscription", err) }
+		res.Items = append(res.Items, s)
+	}
+	if err := rows.Err(); err != nil { return ListResult{}, mapError(ctx, "rows err", err) }
+
+	if len(res.Items) > f.Limit {
+		res.HasMore = true
+		res.Items = res.Items[:f.Limit]
+	}
+	if f.After != nil && f.After.Backward { slices.Reverse(res.Items) }
+
+	if err := r.db.QueryRow(ctx, countBase, countArgs...).Scan(&res.Total); err != nil {
+		return ListResult{}, mapError(ctx, "count subscriptions", err)
+	}
+	return res, nil
+}
+
+type TotalFilters struct {
+	UserID         *uuid.UUID
+	ServiceName    *string
+	From           time.Time
+	To             time.Time
+	IncludeDeleted bool
+	// AsOf evaluates the totals over the subscriptions as they were stored at that instant.
+	AsOf           *time.Time
+	// Amortize spreads charges of billing cycles longer than a month evenly over their months
+	// instead of counting them in the month they fall in.
+	Amortize       bool
+}
+
+// overlapSource clips every subscription to the [$1, $2] window: the period starts at
+// max(start_date, from) and ends at min(end_date, to), an open end_date meaning "until to".
+const overlapSource = `SELECT id, service_name, price, currency, user_id, start_date, end_date,
+	billing_anchor, billing_period, billing_interval,
+	GREATEST(start_date, $1::date) AS clip_start,
+	LEAST(COALESCE(end_date, $2::date), $2::date) AS clip_end
+	FROM `
+
+// overlapMonths counts calendar months between clip_start and clip_end inclusive, never below zero.
+const overlapMonths = `GREATEST((EXTRACT(YEAR FROM clip_end)::int - EXTRACT(YEAR FROM clip_start)::int) * 12
+	+ EXTRACT(MONTH FROM clip_end)::int - EXTRACT(MONTH FROM clip_start)::int + 1, 0)`
+
+// overlapCharge is what a row of overlapQuery charges between clip_start and clip_end: its price
+// times the charges falling into those months, or the amortized share with $3.
+const overlapCharge = `charged_between(price, billing_anchor, billing_period, billing_interval, clip_start, clip_end, $3::boolean)`
+
+// overlapCharges counts the charges falling between clip_start and clip_end, amortized or not.
+const overlapCharges = `charged_between(1, billing_anchor, billing_period, billing_interval, clip_start, clip_end, false)::int`
+
+func overlapQuery(f TotalFilters) (string, []any) {
+	b := whereBuilder{args: []any{f.From, f.To, f.Amortize}}
+	src := chargedSegments(&b, f.AsOf)
+	applyFilters(&b, f.UserID, f.ServiceName, &f.From, &f.To)
+	if !f.IncludeDeleted { b.add("deleted_at IS NULL") }
+	return `SELECT * FROM (` + overlapSource + src + b.sql() + `) o WHERE clip_end >= $1::date`, b.args
+}
+
+// SumOverlapMonths returns what all subscriptions overlapping [From, To] charge in it, at the
+// price effective when each charge falls. Amounts in different currencies cannot be added, so
+// there is one sum per currency, ordered by currency, and none when nothing matches.
+func (r *SubscriptionRepository) SumOverlapMonths(ctx context.Context, f TotalFilters) ([]models.Money, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Aggregate)
+	defer cancel()
+	src, args := overlapQuery(f)
+	q := `SELECT currency, SUM(` + overlapCharge + `)::bigint FROM (` + src + `) t GROUP BY currency ORDER BY currency`
+	rows, err := r.db.Query(ctx, q, args...)
+	if err != nil { return nil, mapError(ctx, "sum subscriptions", err) }
+	defer rows.Close()
+
+	var sums []models.Money
+	for rows.Next() {
+		var m models.Money
+		if err := rows.Scan(&m.Currency, &m.Amount); err != nil {
+			return nil, mapError(ctx, "scan sum", err)
 		}
-		items = append(items, s)
+		sums = append(sums, m)
 	}
-	if err := rows.Err(); err != nil { return nil, 0, fmt.Errorf("rows err: %w", err) }
+	if err := rows.Err(); err != nil { return nil, mapError(ctx, "rows err", err) }
+	return sums, nil
+}
 
-	var total int
-	if err := r.pool.QueryRow(ctx, countBase, args...).Scan(&total); err != nil {
-		return nil, 0, fmt.Errorf("count subscriptions: %w", err)
+const (
+	GroupByMonth       = "month"
+	GroupByServiceName = "service_name"
+	GroupByUserID      = "user_id"
+)
+
+type Bucket struct {
+	Key           string
+	Amount        models.Money
+	Subscriptions int
+}
+
+// SumOverlapMonthsGrouped splits SumOverlapMonths into buckets, one per key and currency. Month
+// buckets cover every month of the window; an empty month is a single bucket without currency.
+// The bucket amounts of a currency always add up to its SumOverlapMonths.
+func (r *SubscriptionRepository) SumOverlapMonthsGrouped(ctx context.Context, f TotalFilters, groupBy string) ([]Bucket, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Aggregate)
+	defer cancel()
+	src, args := overlapQuery(f)
+	var q string
+	switch groupBy {
+	case GroupByMonth:
+		q = `SELECT to_char(g.m, 'MM-YYYY'), COALESCE(t.currency::text, ''),
+				COALESCE(SUM(charged_between(t.price, t.billing_anchor, t.billing_period, t.billing_interval, g.m::date, g.m::date, $3::boolean)), 0)::bigint,
+				count(DISTINCT t.id)
+			FROM generate_series($1::date::timestamp, $2::date::timestamp, interval '1 month') AS g(m)
+			LEFT JOIN (` + src + `) t ON g.m::date BETWEEN date_trunc('month', t.clip_start)::date AND date_trunc('month', t.clip_end)::date
+			GROUP BY g.m, t.currency ORDER BY g.m, 2`
+	case GroupByServiceName, GroupByUserID:
+		q = `SELECT ` + groupBy + `::text, currency, SUM(` + overlapCharge + `)::bigint, count(DISTINCT id)
+			FROM (` + src + `) t GROUP BY ` + groupBy + `, currency ORDER BY 1, 2`
+	default:
+		return nil, models.Validation("invalid_group_by", fmt.Sprintf("unsupported group by: %s", groupBy))
 	}
-	return items, total, nil
+
+	rows, err := r.db.Query(ctx, q, args...)
+	if err != nil { return nil, mapError(ctx, "group subscriptions", err) }
+	defer rows.Close()
+
+	var buckets []Bucket
+	for rows.Next() {
+		var b Bucket
+		if err := rows.Scan(&b.Key, &b.Amount.Currency, &b.Amount.Amount, &b.Subscriptions); err != nil {
+			return nil, mapError(ctx, "scan bucket", err)
+		}
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil { return nil, mapError(ctx, "rows err", err) }
+	return buckets, nil
+}
+
+type Contribution struct {
+	SubscriptionID  uuid.UUID
+	ServiceName     string
+	UserID          uuid.UUID
+	Price           models.Money
+	Start           time.Time
+	End             time.Time
+	Months          int
+	// Charges is how many times the price falls due in those months; Amount is Price times
+	// Charges unless amortized.
+	Charges         int
+	BillingPeriod   string
+	BillingInterval int
+	Amount          models.Money
 }
 
+// OverlapContributions returns the terms that SumOverlapMonths adds up, one per subscription and
+// price segment, so a price change shows up as two contributions of the same subscription.
+func (r *SubscriptionRepository) OverlapContributions(ctx context.Context, f TotalFilters) ([]Contribution, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Aggregate)
+	defer cancel()
+	src, args := overlapQuery(f)
+	q := `SELECT id, service_name, user_id, price, currency, clip_start, clip_end, months, ` + overlapCharges + `, billing_period, billing_interval, ` + overlapCharge + `
+		FROM (SELECT *, ` + overlapMonths + ` AS months FROM (` + src + `) o) t ORDER BY start_date, id`
 
+	rows, err := r.db.Query(ctx, q, args...)
+	if err != nil { return nil, mapError(ctx, "explain subscriptions", err) }
+	defer rows.Close()
+
+	var items []Contribution
+	for rows.Next() {
+		var c Contribution
+		if err := rows.Scan(&c.SubscriptionID, &c.ServiceName, &c.UserID, &c.Price.Amount, &c.Price.Currency, &c.Start, &c.End, &c.Months, &c.Charges, &c.BillingPeriod, &c.BillingInterval, &c.Amount.Amount); err != nil {
+			return nil, mapError(ctx, "scan contribution", err)
+		}
+		c.Amount.Currency = c.Price.Currency
+		items = append(items, c)
+	}
+	if err := rows.Err(); err != nil { return nil, mapError(ctx, "rows err", err) }
+	return items, nil
+}
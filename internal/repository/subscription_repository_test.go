@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	appdb "subscription-service/internal/db"
+	"subscription-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// testRepository connects to the database named by SUBS_TEST_POSTGRES_DSN and migrates it;
+// tests that need Postgres are skipped without one.
+func testRepository(t *testing.T) *SubscriptionRepository {
+	t.Helper()
+	dsn := os.Getenv("SUBS_TEST_POSTGRES_DSN")
+	if dsn == "" { t.Skip("SUBS_TEST_POSTGRES_DSN is not set") }
+	ctx := context.Background()
+	t.Chdir("../..") // migrations are looked up relative to the repository root
+	if err := appdb.RunMigrations(ctx, dsn); err != nil { t.Fatalf("migrate: %v", err) }
+	pg, err := appdb.Connect(ctx, dsn, 1, 4)
+	if err != nil { t.Fatalf("connect: %v", err) }
+	t.Cleanup(pg.Close)
+	return NewSubscriptionRepository(pg.Pool, Timeouts{})
+}
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// monthsBetweenInclusive and referenceTotal are the Go implementation that the total was
+// computed with before it moved into SQL, kept as the reference for SumOverlapMonths.
+func monthsBetweenInclusive(a, b time.Time) int {
+	return (int(b.Year())-int(a.Year()))*12 + int(b.Month()) - int(a.Month()) + 1
+}
+
+func referenceTotal(items []models.Subscription, from, to time.Time) int64 {
+	var sum int64
+	for _, sbs := range items {
+		start := sbs.StartDate
+		end := to
+		if sbs.EndDate != nil && sbs.EndDate.Before(to) { end = *sbs.EndDate }
+		if end.Before(from) || start.After(to) { continue }
+		if start.Before(from) { start = from }
+		months := monthsBetweenInclusive(start, end)
+		if months < 0 { months = 0 }
+		sum += sbs.Price.Amount * int64(months)
+	}
+	return sum
+}
+
+func TestSumOverlapMonthsMatchesReference(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	end := func(year int, m time.Month) *time.Time {
+		e := month(year, m)
+		return &e
+	}
+	type sub struct {
+		start time.Time
+		end   *time.Time
+		price int64
+	}
+	cases := []struct {
+		name     string
+		from, to time.Time
+		subs     []sub
+	}{
+		{"open end date", month(2024, 1), month(2024, 6), []sub{{month(2024, 3), nil, 19900}}},
+		{"end date before from", month(2024, 1), month(2024, 6), []sub{{month(2023, 1), end(2023, 11), 19900}}},
+		{"start after to", month(2024, 1), month(2024, 6), []sub{{month(2024, 8), nil, 19900}}},
+		{"start before from", month(2024, 1), month(2024, 6), []sub{{month(2023, 6), end(2024, 4), 19900}}},
+		{"end date after to", month(2024, 1), month(2024, 6), []sub{{month(2024, 2), end(2025, 1), 19900}}},
+		{"single month", month(2024, 1), month(2024, 6), []sub{{month(2024, 5), end(2024, 5), 19900}}},
+		{"window crosses a year boundary", month(2023, 10), month(2024, 3), []sub{{month(2023, 11), end(2024, 2), 19900}}},
+		{"subscription crosses a year boundary", month(2024, 1), month(2024, 6), []sub{{month(2023, 12), nil, 19900}}},
+		{"several subscriptions", month(2023, 11), month(2024, 2), []sub{
+			{month(2023, 1), nil, 100},
+			{month(2023, 12), end(2024, 1), 25050},
+			{month(2022, 1), end(2023, 10), 999},
+			{month(2024, 3), nil, 1},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			userID := uuid.New()
+			var items []models.Subscription
+			for _, s := range tc.subs {
+				created, err := repo.Create(ctx, models.Subscription{
+					ID: uuid.New(), ServiceName: "Reference", UserID: userID,
+					Price: models.Money{Amount: s.price, Currency: "RUB"}, StartDate: s.start, EndDate: s.end,
+					BillingPeriod: models.BillingMonthly, BillingInterval: 1,
+				})
+				if err != nil { t.Fatalf("create: %v", err) }
+				items = append(items, created)
+			}
+			sums, err := repo.SumOverlapMonths(ctx, TotalFilters{UserID: &userID, From: tc.from, To: tc.to})
+			if err != nil { t.Fatalf("sum: %v", err) }
+			var got int64
+			for _, m := range sums {
+				if m.Currency != "RUB" { t.Fatalf("sum in unexpected currency %q", m.Currency) }
+				got += m.Amount
+			}
+			if want := referenceTotal(items, tc.from, tc.to); got != want {
+				t.Fatalf("SumOverlapMonths = %d, reference = %d", got, want)
+			}
+		})
+	}
+}
+
+func TestSumOverlapMonthsSplitsCurrencies(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	userID := uuid.New()
+	for _, price := range []models.Money{{Amount: 1500, Currency: "JPY"}, {Amount: 999, Currency: "USD"}, {Amount: 1001, Currency: "USD"}} {
+		_, err := repo.Create(ctx, models.Subscription{
+			ID: uuid.New(), ServiceName: "Currencies", UserID: userID, Price: price, StartDate: month(2024, 1),
+			BillingPeriod: models.BillingMonthly, BillingInterval: 1,
+		})
+		if err != nil { t.Fatalf("create: %v", err) }
+	}
+	sums, err := repo.SumOverlapMonths(ctx, TotalFilters{UserID: &userID, From: month(2024, 1), To: month(2024, 2)})
+	if err != nil { t.Fatalf("sum: %v", err) }
+	want := []models.Money{{Amount: 3000, Currency: "JPY"}, {Amount: 4000, Currency: "USD"}}
+	if len(sums) != len(want) { t.Fatalf("SumOverlapMonths = %v, want %v", sums, want) }
+	for i := range want {
+		if sums[i] != want[i] { t.Fatalf("SumOverlapMonths = %v, want %v", sums, want) }
+	}
+}
+
+func TestChargedThrough(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	cases := []struct {
+		name     string
+		price    int64
+		n, step  int
+		amortize bool
+		want     int64
+	}{
+		{"nothing before the first unit", 1000, 0, 3, false, 0},
+		{"negative units charge nothing", 1000, -2, 3, false, 0},
+		{"first unit charges a whole cycle", 1000, 1, 3, false, 1000},
+		{"last unit of the first cycle", 1000, 3, 3, false, 1000},
+		{"first unit of the second cycle", 1000, 4, 3, false, 2000},
+		{"amortized first unit rounds down", 1000, 1, 3, true, 333},
+		{"amortized second unit rounds down", 1000, 2, 3, true, 666},
+		{"amortized cycle adds up to price", 1000, 3, 3, true, 1000},
+		{"amortized into the second cycle", 1000, 4, 3, true, 1333},
+		{"amortized yearly", 100, 5, 12, true, 41},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got int64
+			err := repo.db.QueryRow(ctx, `SELECT charged_through($1::bigint, $2::int, $3::int, $4::boolean)`, tc.price, tc.n, tc.step, tc.amortize).Scan(&got)
+			if err != nil { t.Fatalf("charged_through: %v", err) }
+			if got != tc.want { t.Fatalf("charged_through(%d, %d, %d, %v) = %d, want %d", tc.price, tc.n, tc.step, tc.amortize, got, tc.want) }
+		})
+	}
+}
+
+func TestChargedBetween(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	cases := []struct {
+		name     string
+		price    int64
+		anchor   time.Time
+		period   string
+		every    int
+		lo, hi   time.Time
+		amortize bool
+		want     int64
+	}{
+		// 2024-01-01 is a Monday, so the weekly charges of January fall on the 1st, 8th, 15th, 22nd and 29th.
+		{"weekly from a Monday, first month", 100, month(2024, 1), models.BillingWeekly, 1, month(2024, 1), month(2024, 1), false, 500},
+		{"weekly from a Monday, next month", 100, month(2024, 1), models.BillingWeekly, 1, month(2024, 2), month(2024, 2), false, 400},
+		// 2024-02-01 is a Thursday: February 1st, 8th, 15th, 22nd and 29th, then four Thursdays in March.
+		{"weekly from a Thursday, first month", 100, month(2024, 2), models.BillingWeekly, 1, month(2024, 2), month(2024, 2), false, 500},
+		{"weekly from a Thursday, next month", 100, month(2024, 2), models.BillingWeekly, 1, month(2024, 3), month(2024, 3), false, 400},
+		{"fortnightly, first month", 100, month(2024, 1), models.BillingWeekly, 2, month(2024, 1), month(2024, 1), false, 300},
+		{"fortnightly, next month", 100, month(2024, 1), models.BillingWeekly, 2, month(2024, 2), month(2024, 2), false, 200},
+		{"weekly window starting before the anchor", 100, month(2024, 1), models.BillingWeekly, 1, month(2023, 12), month(2024, 1), false, 500},
+		{"weekly ignores amortize", 100, month(2024, 1), models.BillingWeekly, 1, month(2024, 2), month(2024, 2), true, 400},
+		{"quarterly renewal month", 1000, month(2024, 1), models.BillingQuarterly, 1, month(2024, 1), month(2024, 3), false, 1000},
+		{"quarterly without renewal", 1000, month(2024, 1), models.BillingQuarterly, 1, month(2024, 2), month(2024, 3), false, 0},
+		{"quarterly second renewal", 1000, month(2024, 1), models.BillingQuarterly, 1, month(2024, 4), month(2024, 4), false, 1000},
+		{"every second quarter", 1000, month(2024, 1), models.BillingQuarterly, 2, month(2024, 2), month(2024, 12), false, 1000},
+		{"yearly renewal inside the window", 1200, month(2024, 3), models.BillingYearly, 1, month(2024, 1), month(2024, 12), false, 1200},
+		{"yearly window missing the renewal", 1200, month(2024, 3), models.BillingYearly, 1, month(2024, 4), month(2025, 2), false, 0},
+		{"yearly second renewal", 1200, month(2024, 3), models.BillingYearly, 1, month(2025, 3), month(2025, 3), false, 1200},
+		{"every second year skips a year", 1200, month(2024, 3), models.BillingYearly, 2, month(2025, 3), month(2025, 3), false, 0},
+		{"amortized yearly", 1200, month(2024, 3), models.BillingYearly, 1, month(2024, 4), month(2024, 6), true, 300},
+		// Amortized, the months of a cycle get 333, 333 and 334: each is the difference of cumulative
+		// amounts rounded down, so the cycle still adds up to the price.
+		{"amortized quarterly first month", 1000, month(2024, 1), models.BillingQuarterly, 1, month(2024, 1), month(2024, 1), true, 333},
+		{"amortized quarterly second month", 1000, month(2024, 1), models.BillingQuarterly, 1, month(2024, 2), month(2024, 2), true, 333},
+		{"amortized quarterly third month", 1000, month(2024, 1), models.BillingQuarterly, 1, month(2024, 3), month(2024, 3), true, 334},
+		{"amortized quarterly whole cycle", 1000, month(2024, 1), models.BillingQuarterly, 1, month(2024, 1), month(2024, 3), true, 1000},
+		{"monthly", 199, month(2024, 1), models.BillingMonthly, 1, month(2024, 2), month(2024, 4), false, 597},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got int64
+			err := repo.db.QueryRow(ctx, `SELECT charged_between($1::bigint, $2::date, $3::text, $4::int, $5::date, $6::date, $7::boolean)`,
+				tc.price, tc.anchor, tc.period, tc.every, tc.lo, tc.hi, tc.amortize).Scan(&got)
+			if err != nil { t.Fatalf("charged_between: %v", err) }
+			if got != tc.want { t.Fatalf("charged_between = %d, want %d", got, tc.want) }
+		})
+	}
+}
+
+// TestPriceSegmentsKeepTheBillingAnchor checks that a price change splits a subscription into
+// segments that are still billed from its start month, not from the month the change takes effect.
+func TestPriceSegmentsKeepTheBillingAnchor(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	cases := []struct {
+		name          string
+		period        string
+		price, change int64
+		changeFrom    time.Time
+		from, to      time.Time
+		amortize      bool
+		want          int64
+	}{
+		// Charged in January at 3000, then in April at 6000; re-anchoring on March would charge March and June.
+		{"quarterly", models.BillingQuarterly, 3000, 6000, month(2024, 3), month(2024, 1), month(2024, 6), false, 9000},
+		// February is charged on the 5th, 12th, 19th and 26th, not from the 1st.
+		{"weekly", models.BillingWeekly, 100, 200, month(2024, 2), month(2024, 2), month(2024, 2), false, 800},
+		// January amortizes a third of 3000; February and March two thirds of 6000.
+		{"amortized quarterly", models.BillingQuarterly, 3000, 6000, month(2024, 2), month(2024, 1), month(2024, 3), true, 5000},
+		// Renewed in January 2025 at the new price, a year after the start rather than after the change.
+		{"yearly", models.BillingYearly, 1200, 2400, month(2024, 7), month(2024, 7), month(2025, 6), false, 2400},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			userID := uuid.New()
+			created, err := repo.Create(ctx, models.Subscription{
+				ID: uuid.New(), ServiceName: "Segments", UserID: userID,
+				Price: models.Money{Amount: tc.price, Currency: "RUB"}, StartDate: month(2024, 1),
+				BillingPeriod: tc.period, BillingInterval: 1,
+			})
+			if err != nil { t.Fatalf("create: %v", err) }
+			if _, err := repo.AddPriceChange(ctx, PriceChange{SubscriptionID: created.ID, EffectiveFrom: tc.changeFrom, Price: tc.change}); err != nil {
+				t.Fatalf("add price change: %v", err)
+			}
+			sums, err := repo.SumOverlapMonths(ctx, TotalFilters{UserID: &userID, From: tc.from, To: tc.to, Amortize: tc.amortize})
+			if err != nil { t.Fatalf("sum: %v", err) }
+			if len(sums) != 1 || sums[0].Amount != tc.want { t.Fatalf("SumOverlapMonths = %v, want %d RUB", sums, tc.want) }
+		})
+	}
+}
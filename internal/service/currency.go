@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tracing"
+)
+
+// BaseCurrency is the currency exchange rates are quoted against, as in the ECB reference rates.
+const BaseCurrency = "EUR"
+
+var decimalRate = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+const (
+	RatesFormatCSV = "csv"
+	RatesFormatXML = "xml"
+)
+
+// AppliedRate reports the conversion used for one month and source currency. Rate is the
+// number of To units per From unit; the dates are those of the underlying reference rates and
+// are empty for the base currency.
+type AppliedRate struct {
+	Month    string
+	From     string
+	To       string
+	Rate     string
+	FromDate string
+	ToDate   string
+}
+
+type ConvertedTotal struct {
+	Amount models.Money
+	Rates  []AppliedRate
+}
+
+// TotalIn computes the total like Total but converts every month's charge into currency at
+// that month's rate before adding it up. The result is rounded to minor units once, at the end.
+// With q.AsOf, only the rates loaded by then are used.
+func (s *SubscriptionService) TotalIn(ctx context.Context, q TotalQuery, currency string) (_ ConvertedTotal, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.TotalIn")
+	defer func() { tracing.End(span, err) }()
+	var v Validator
+	v.Currency("currency", currency)
+	if err := v.Err(); err != nil { return ConvertedTotal{}, err }
+	f, err := totalFilters(q)
+	if err != nil { return ConvertedTotal{}, err }
+	charges, err := s.repo.MonthlyCharges(ctx, f)
+	if err != nil { return ConvertedTotal{}, err }
+
+	var months []time.Time
+	currencies := []string{currency}
+	for _, c := range charges {
+		if len(months) == 0 || !months[len(months)-1].Equal(c.Month) { months = append(months, c.Month) }
+		if !slices.Contains(currencies, c.Currency) { currencies = append(currencies, c.Currency) }
+	}
+	currencies = slices.DeleteFunc(currencies, func(c string) bool { return c == BaseCurrency })
+	rates := map[string]repository.MonthRate{}
+	if len(months) > 0 && len(currencies) > 0 {
+		found, err := s.repo.RatesForMonths(ctx, months, currencies, q.AsOf)
+		if err != nil { return ConvertedTotal{}, err }
+		for _, r := range found { rates[rateKey(r.Month, r.Currency)] = r }
+	}
+	// perEuro returns how many units of cur one euro buys in month, and the reference rate date.
+	perEuro := func(month time.Time, cur string) (*big.Rat, string, error) {
+		if cur == BaseCurrency { return big.NewRat(1, 1), "", nil }
+		r := rates[rateKey(month, cur)]
+		if r.Rate == nil {
+			return nil, "", models.Validation("exchange_rate_missing", fmt.Sprintf("no %s exchange rate known for %s", cur, month.Format(monthYearLayout)))
+		}
+		rate, ok := new(big.Rat).SetString(*r.Rate)
+		if !ok { return nil, "", models.Internal("parse exchange rate", fmt.Errorf("invalid rate %q", *r.Rate)) }
+		return rate, r.Date.Format(time.DateOnly), nil
+	}
+
+	var out ConvertedTotal
+	sum := new(big.Rat)
+	for _, c := range charges {
+		amount := new(big.Rat).SetInt64(c.Amount)
+		if c.Currency == currency {
+			sum.Add(sum, amount)
+			continue
+		}
+		from, fromDate, err := perEuro(c.Month, c.Currency)
+		if err != nil { return ConvertedTotal{}, err }
+		to, toDate, err := perEuro(c.Month, currency)
+		if err != nil { return ConvertedTotal{}, err }
+		rate := new(big.Rat).Quo(to, from)
+		// Rates are per major unit while charges are in minor units, whose size differs by currency.
+		scale := pow10Rat(models.Exponent(currency) - models.Exponent(c.Currency))
+		sum.Add(sum, amount.Mul(amount, scale.Mul(scale, rate)))
+		out.Rates = append(out.Rates, AppliedRate{
+			Month: c.Month.Format(monthYearLayout), From: c.Currency, To: currency,
+			Rate: rate.FloatString(6), FromDate: fromDate, ToDate: toDate,
+		})
+	}
+	if out.Amount, err = models.RoundMoney(sum, currency); err != nil { return ConvertedTotal{}, err }
+	return out, nil
+}
+
+func pow10Rat(n int) *big.Rat {
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(max(n, -n))), nil)
+	if n < 0 { return new(big.Rat).SetFrac(big.NewInt(1), p) }
+	return new(big.Rat).SetInt(p)
+}
+
+func rateKey(month time.Time, currency string) string {
+	return month.Format(time.DateOnly) + "/" + currency
+}
+
+// LoadExchangeRates parses reference rates in the given format and stores them, returning how
+// many were loaded. Both formats quote units of currency per euro.
+func (s *SubscriptionService) LoadExchangeRates(ctx context.Context, r io.Reader, format string) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.LoadExchangeRates")
+	defer func() { tracing.End(span, err) }()
+	var rates []repository.ExchangeRate
+	switch format {
+	case RatesFormatCSV:
+		rates, err = ParseRatesCSV(r)
+	case RatesFormatXML:
+		rates, err = ParseRatesECB(r)
+	default:
+		return 0, models.Validation("unsupported_rates_format", fmt.Sprintf("unsupported exchange rates format %q", format))
+	}
+	if err != nil { return 0, err }
+	if len(rates) == 0 { return 0, models.Validation("no_exchange_rates", "the file contains no exchange rates") }
+	if _, err := s.repo.AddExchangeRates(ctx, rates); err != nil { return 0, err }
+	logger.FromContext(ctx).Info("exchange rates loaded", zap.Int("rates", len(rates)), zap.String("format", format))
+	return len(rates), nil
+}
+
+// ParseRatesCSV reads "date,currency,rate" records such as "2025-07-01,USD,1.1732", with an
+// optional header line.
+func ParseRatesCSV(r io.Reader) ([]repository.ExchangeRate, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 3
+	cr.TrimLeadingSpace = true
+	var rates []repository.ExchangeRate
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) { return rates, nil }
+		if err != nil { return nil, models.Validation("invalid_rates_file", err.Error()) }
+		if line == 1 && strings.EqualFold(rec[0], "date") { continue }
+		rate, err := parseRate(rec[0], rec[1], rec[2])
+		if err != nil { return nil, models.Validation("invalid_rates_file", fmt.Sprintf("line %d: %v", line, err)) }
+		rates = append(rates, rate)
+	}
+}
+
+// ecbEnvelope matches the ECB eurofxref XML files, daily or historical: one Cube per day,
+// holding one Cube per currency.
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseRatesECB reads an ECB-style eurofxref XML document.
+func ParseRatesECB(r io.Reader) ([]repository.ExchangeRate, error) {
+	var env ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&env); err != nil { return nil, models.Validation("invalid_rates_file", err.Error()) }
+	var rates []repository.ExchangeRate
+	for _, day := range env.Days {
+		for _, rt := range day.Rates {
+			rate, err := parseRate(day.Time, rt.Currency, rt.Rate)
+			if err != nil { return nil, models.Validation("invalid_rates_file", fmt.Sprintf("%s %s: %v", day.Time, rt.Currency, err)) }
+			rates = append(rates, rate)
+		}
+	}
+	return rates, nil
+}
+
+func parseRate(date, currency, rate string) (repository.ExchangeRate, error) {
+	d, err := time.Parse(time.DateOnly, strings.TrimSpace(date))
+	if err != nil { return repository.ExchangeRate{}, fmt.Errorf("invalid date %q", date) }
+	currency = strings.TrimSpace(currency)
+	if !currencyCode.MatchString(currency) { return repository.ExchangeRate{}, fmt.Errorf("invalid currency %q", currency) }
+	rate = strings.TrimSpace(rate)
+	if v, ok := new(big.Rat).SetString(rate); !ok || !decimalRate.MatchString(rate) || v.Sign() <= 0 { return repository.ExchangeRate{}, fmt.Errorf("invalid rate %q", rate) }
+	return repository.ExchangeRate{Currency: currency, Date: d, Rate: rate}, nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"subscription-service/internal/repository"
+)
+
+type cursorPayload struct {
+	Sort     string    `json:"s"`
+	Values   []string  `json:"v"`
+	ID       uuid.UUID `json:"i"`
+	Backward bool      `json:"b,omitempty"`
+}
+
+// EncodeCursor turns a keyset position into the opaque token handed to API clients. The sort
+// order is embedded so that a cursor cannot be replayed against a different order.
+func EncodeCursor(keys []repository.SortKey, c repository.Cursor) string {
+	raw, _ := json.Marshal(cursorPayload{Sort: repository.SortSignature(keys), Values: c.Values, ID: c.ID, Backward: c.Backward})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses a token produced by EncodeCursor and returns it with its sort signature.
+func DecodeCursor(s string) (string, repository.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil { return "", repository.Cursor{}, err }
+	var p cursorPayload
+	if err := json.Unmarshal(raw, &p); err != nil { return "", repository.Cursor{}, err }
+	if p.ID == uuid.Nil || p.Sort == "" { return "", repository.Cursor{}, errors.New("incomplete cursor") }
+	return p.Sort, repository.Cursor{Values: p.Values, ID: p.ID, Backward: p.Backward}, nil
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tracing"
+)
+
+// recordEvent appends an audit entry for a write performed through tx, attributing it to the
+// actor and request of ctx.
+func recordEvent(ctx context.Context, tx *repository.SubscriptionRepository, typ string, before, after *models.Subscription) error {
+	e, err := newEvent(ctx, typ, before, after)
+	if err != nil { return err }
+	return tx.AppendEvent(ctx, e)
+}
+
+// recordPriceChange appends the price_changed entry of change, which moved the subscription from
+// before to after.
+func recordPriceChange(ctx context.Context, tx *repository.SubscriptionRepository, before, after *models.Subscription, change PricePoint) error {
+	e, err := newEvent(ctx, repository.EventPriceChanged, before, after)
+	if err != nil { return err }
+	if e.PriceChange, err = json.Marshal(priceChangeJSON(change)); err != nil { return models.Internal("encode price change", err) }
+	return tx.AppendEvent(ctx, e)
+}
+
+// priceChangeJSON is how a price change is stored in its event, e.g.
+// {"effective_from":"09-2025","price":{"amount":"249.00","currency":"RUB"}}.
+type priceChangeJSON struct {
+	EffectiveFrom string       `json:"effective_from"`
+	Price         models.Money `json:"price"`
+}
+
+func newEvent(ctx context.Context, typ string, before, after *models.Subscription) (repository.Event, error) {
+	e := repository.Event{Type: typ, Actor: logger.Actor(ctx), RequestID: logger.RequestID(ctx)}
+	for _, snap := range []struct {
+		m   *models.Subscription
+		dst *[]byte
+	}{{before, &e.Before}, {after, &e.After}} {
+		if snap.m == nil { continue }
+		e.SubscriptionID = snap.m.ID
+		b, err := json.Marshal(snap.m)
+		if err != nil { return e, models.Internal("encode subscription snapshot", err) }
+		*snap.dst = b
+	}
+	return e, nil
+}
+
+type HistoryQuery struct {
+	Limit  int
+	Cursor string
+}
+
+// HistoryEvent is an audit entry with its snapshots decoded; Before is nil for creations and
+// PriceChange is set for price_changed events only.
+type HistoryEvent struct {
+	ID          int64
+	Type        string
+	Actor       string
+	RequestID   string
+	Before      *models.Subscription
+	After       *models.Subscription
+	PriceChange *PricePoint
+	OccurredAt  time.Time
+}
+
+type HistoryPage struct {
+	Events     []HistoryEvent
+	NextCursor string
+}
+
+// decodeSnapshot reads a snapshot written by recordEvent. The audit trail is append-only, so
+// snapshots taken before prices carried their currency keep "price" as a number of major units,
+// next to "currency" or, older still, without one, which meant the default currency; snapshots
+// from before billing periods lack them, which meant monthly.
+func decodeSnapshot(b []byte) (*models.Subscription, error) {
+	if b == nil { return nil, nil }
+	var snap struct {
+		models.Subscription
+		Price    json.RawMessage `json:"price"`
+		Currency string          `json:"currency"`
+	}
+	if err := json.Unmarshal(b, &snap); err != nil { return nil, models.Internal("decode subscription snapshot", err) }
+	s := snap.Subscription
+	if len(snap.Price) > 0 && snap.Price[0] == '{' {
+		if err := json.Unmarshal(snap.Price, &s.Price); err != nil { return nil, models.Internal("decode subscription snapshot", err) }
+	} else {
+		currency := snap.Currency
+		if currency == "" { currency = DefaultCurrency }
+		price, err := models.ParseMoney(string(snap.Price), currency)
+		if err != nil { return nil, models.Internal("decode subscription snapshot", fmt.Errorf("price %s %w", snap.Price, err)) }
+		s.Price = price
+	}
+	if s.BillingPeriod == "" { s.BillingPeriod = models.BillingMonthly }
+	if s.BillingInterval == 0 { s.BillingInterval = 1 }
+	return &s, nil
+}
+
+func encodeEventCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeEventCursor(s string) (int64, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil { return 0, false }
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	return id, err == nil && id > 0
+}
+
+// History returns the audit trail of a subscription, newest first. Deleted subscriptions keep
+// their history.
+func (s *SubscriptionService) History(ctx context.Context, id uuid.UUID, q HistoryQuery) (_ HistoryPage, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.History")
+	defer func() { tracing.End(span, err) }()
+	var v Validator
+	v.Check(q.Limit > 0 && q.Limit <= MaxListLimit, "limit", CodeOutOfRange, fmt.Sprintf("limit must be between 1 and %d", MaxListLimit))
+	var before *int64
+	if q.Cursor != "" {
+		if n, ok := decodeEventCursor(q.Cursor); ok {
+			before = &n
+		} else {
+			v.Add("cursor", CodeInvalidFormat, "cursor is malformed")
+		}
+	}
+	if err := v.Err(); err != nil { return HistoryPage{}, err }
+
+	events, hasMore, err := s.repo.ListEvents(ctx, id, before, q.Limit)
+	if err != nil { return HistoryPage{}, err }
+	if len(events) == 0 && before == nil {
+		// Rows created before the audit trail existed have no events but are still found.
+		exists, err := s.repo.Exists(ctx, id)
+		if err != nil { return HistoryPage{}, err }
+		if !exists { return HistoryPage{}, models.NotFound("subscription_not_found", "subscription not found") }
+	}
+	page := HistoryPage{Events: make([]HistoryEvent, 0, len(events))}
+	for _, e := range events {
+		he := HistoryEvent{ID: e.ID, Type: e.Type, Actor: e.Actor, RequestID: e.RequestID, OccurredAt: e.OccurredAt}
+		if he.Before, err = decodeSnapshot(e.Before); err != nil { return HistoryPage{}, err }
+		if he.After, err = decodeSnapshot(e.After); err != nil { return HistoryPage{}, err }
+		if e.PriceChange != nil {
+			var change priceChangeJSON
+			if err := json.Unmarshal(e.PriceChange, &change); err != nil { return HistoryPage{}, models.Internal("decode price change", err) }
+			he.PriceChange = &PricePoint{EffectiveFrom: change.EffectiveFrom, Price: change.Price}
+		}
+		page.Events = append(page.Events, he)
+	}
+	if hasMore { page.NextCursor = encodeEventCursor(events[len(events)-1].ID) }
+	return page, nil
+}
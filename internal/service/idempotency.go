@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tracing"
+)
+
+const MaxIdempotencyKeyLength = 255
+
+// fingerprint identifies a create request by the subscription it creates, so a retry can be
+// told apart from a different request that reuses the same key. It covers the validated,
+// defaulted fields, so "199" and "199.00" or an omitted and an explicit default currency are the
+// same request. A field added to subscriptions must be added here too.
+func fingerprint(s models.Subscription) string {
+	end := ""
+	if s.EndDate != nil { end = s.EndDate.Format(monthYearLayout) }
+	b, _ := json.Marshal([]any{
+		s.ServiceName,
+		s.UserID,
+		s.Price.Amount,
+		s.Price.Currency,
+		s.StartDate.Format(monthYearLayout),
+		end,
+		s.BillingPeriod,
+		s.BillingInterval,
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateIdempotent creates a subscription at most once per key. A retry with the same key and
+// body returns the subscription stored by the first call with replayed=true; the same key with
+// a different body is rejected.
+func (s *SubscriptionService) CreateIdempotent(ctx context.Context, key string, req CreateInput) (_ models.Subscription, replayed bool, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.CreateIdempotent")
+	defer func() { tracing.End(span, err) }()
+	var v Validator
+	v.Check(len(key) <= MaxIdempotencyKeyLength, "Idempotency-Key", CodeTooLong,
+		fmt.Sprintf("Idempotency-Key must be at most %d characters", MaxIdempotencyKeyLength))
+	if err := v.Err(); err != nil { return models.Subscription{}, false, err }
+	in, err := validateInput(req)
+	if err != nil { return models.Subscription{}, false, err }
+
+	sub := newSubscription(req, in)
+	fp := fingerprint(sub)
+	var out models.Subscription
+	err = s.repo.InTx(ctx, func(tx *repository.SubscriptionRepository) error {
+		rec, claimed, err := tx.ClaimIdempotencyKey(ctx, key, fp, s.opts.IdempotencyTTL)
+		if err != nil { return err }
+		if !claimed {
+			if rec.Fingerprint != fp {
+				return models.Validation("idempotency_key_reused", "Idempotency-Key was already used with a different request body")
+			}
+			replayed = true
+			if err := json.Unmarshal(rec.Response, &out); err != nil { return models.Internal("decode idempotent response", err) }
+			return nil
+		}
+		created, err := createTx(ctx, tx, sub)
+		if err != nil { return err }
+		b, err := json.Marshal(created)
+		if err != nil { return models.Internal("encode idempotent response", err) }
+		if err := tx.CompleteIdempotencyKey(ctx, key, b); err != nil { return err }
+		out = created
+		return nil
+	})
+	if err != nil { return models.Subscription{}, false, err }
+	if replayed {
+		logger.FromContext(ctx).Info("subscription create replayed", zap.Stringer("subscription_id", out.ID))
+	} else {
+		logger.FromContext(ctx).Info("subscription created", zap.Stringer("subscription_id", out.ID))
+	}
+	return out, replayed, nil
+}
+
+// PurgeExpiredIdempotencyKeys removes keys whose TTL has passed.
+func (s *SubscriptionService) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	return s.repo.PurgeExpiredIdempotencyKeys(ctx)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tracing"
+)
+
+type PriceChangeInput struct {
+	EffectiveFrom string
+	// Price is a decimal amount in major units of the subscription's currency.
+	Price         string
+}
+
+// PricePoint is one step of a subscription's price timeline.
+type PricePoint struct {
+	EffectiveFrom string
+	Price         models.Money
+}
+
+// AddPriceChange changes the price of a subscription from a given month on, leaving the months
+// before it, and therefore past totals, untouched. The subscription gets a new version, so ETags
+// taken before the change no longer match, and the change is recorded in its history.
+func (s *SubscriptionService) AddPriceChange(ctx context.Context, id uuid.UUID, in PriceChangeInput, pre Precondition) (_ models.Subscription, _ []PricePoint, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.AddPriceChange")
+	defer func() { tracing.End(span, err) }()
+	var v Validator
+	var ok bool
+	change := repository.PriceChange{SubscriptionID: id}
+	if v.Required("effective_from", in.EffectiveFrom) { change.EffectiveFrom, ok = v.MonthYear("effective_from", in.EffectiveFrom) }
+	if err := v.Err(); err != nil { return models.Subscription{}, nil, err }
+
+	var updated models.Subscription
+	var timeline []PricePoint
+	err = s.repo.InTx(ctx, func(tx *repository.SubscriptionRepository) error {
+		sub, err := tx.GetByID(ctx, id)
+		if err != nil { return err }
+		if err := pre.check(sub); err != nil { return err }
+		if price, ok := v.Money("price", in.Price, sub.Price.Currency); ok {
+			v.Check(price.Amount >= 0, "price", CodeOutOfRange, "price must not be negative")
+			change.Price = price.Amount
+		}
+		v.Check(!ok || change.EffectiveFrom.After(sub.StartDate), "effective_from", CodeInvalidRange,
+			"effective_from must be after start_date; change the subscription price instead")
+		v.Check(!ok || sub.EndDate == nil || !change.EffectiveFrom.After(*sub.EndDate), "effective_from", CodeInvalidRange,
+			"effective_from must not be after end_date")
+		if err := v.Err(); err != nil { return err }
+		if _, err := tx.AddPriceChange(ctx, change); err != nil { return err }
+		if updated, err = tx.Update(ctx, sub); err != nil { return err }
+		point := PricePoint{EffectiveFrom: change.EffectiveFrom.Format(monthYearLayout), Price: models.Money{Amount: change.Price, Currency: sub.Price.Currency}}
+		if err := recordPriceChange(ctx, tx, &sub, &updated, point); err != nil { return err }
+		timeline, err = priceTimeline(ctx, tx, sub.ID, sub.StartDate.Format(monthYearLayout), sub.Price)
+		return err
+	})
+	if err != nil { return models.Subscription{}, nil, err }
+	logger.FromContext(ctx).Info("subscription price changed", zap.Stringer("subscription_id", id), zap.String("effective_from", in.EffectiveFrom))
+	return updated, timeline, nil
+}
+
+// checkTimelineEdit keeps an update from rewriting a price timeline: the stored price is the
+// one from start_date, so once later prices exist, editing it would change past totals, and the
+// later prices are minor units of the current currency, which a new currency would misread.
+// Moving start_date onto or past a change would leave that change outside the timeline, where
+// totals silently skip it.
+func checkTimelineEdit(ctx context.Context, tx *repository.SubscriptionRepository, existing, next models.Subscription) error {
+	if next.Price == existing.Price && next.StartDate.Equal(existing.StartDate) { return nil }
+	changes, err := tx.ListPriceChanges(ctx, existing.ID)
+	if err != nil || len(changes) == 0 { return err }
+	if first := changes[0].EffectiveFrom; !first.After(next.StartDate) {
+		return models.Conflict("price_changes_exist", "start_date must stay before the first price change, effective from "+first.Format(monthYearLayout), nil)
+	}
+	if next.Price.Currency != existing.Price.Currency {
+		return models.Conflict("price_changes_exist", "currency cannot be changed once the subscription has price changes", nil)
+	}
+	if next.Price.Amount != existing.Price.Amount {
+		return models.Conflict("price_changes_exist", "price cannot be edited once the subscription has price changes; add a price change instead", nil)
+	}
+	return nil
+}
+
+// PriceTimeline returns the prices of a subscription in effective order, starting with the
+// price it had at start_date.
+func (s *SubscriptionService) PriceTimeline(ctx context.Context, id uuid.UUID) (_ []PricePoint, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.PriceTimeline")
+	defer func() { tracing.End(span, err) }()
+	sub, err := s.repo.GetByID(ctx, id)
+	if err != nil { return nil, err }
+	return priceTimeline(ctx, s.repo, sub.ID, sub.StartDate.Format(monthYearLayout), sub.Price)
+}
+
+func priceTimeline(ctx context.Context, repo *repository.SubscriptionRepository, id uuid.UUID, start string, price models.Money) ([]PricePoint, error) {
+	changes, err := repo.ListPriceChanges(ctx, id)
+	if err != nil { return nil, err }
+	timeline := []PricePoint{{EffectiveFrom: start, Price: price}}
+	for _, c := range changes {
+		timeline = append(timeline, PricePoint{EffectiveFrom: c.EffectiveFrom.Format(monthYearLayout), Price: models.Money{Amount: c.Price, Currency: price.Currency}})
+	}
+	return timeline, nil
+}
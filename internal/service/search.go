@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tracing"
+)
+
+const (
+	MaxSearchLength     = 100
+	MaxSuggestLimit     = 50
+	DefaultSuggestLimit = 10
+)
+
+// cyrToLat follows the common passport-style romanisation so that "Яндекс Плюс" and
+// "Yandex Plus" end up comparable by trigrams.
+var cyrToLat = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// latToCyr is tried longest match first; "x" is spelled "кс" as in "Яндекс".
+var latToCyr = []struct{ lat, cyr string }{
+	{"shch", "щ"}, {"zh", "ж"}, {"kh", "х"}, {"ts", "ц"}, {"ch", "ч"}, {"sh", "ш"},
+	{"yu", "ю"}, {"ya", "я"}, {"yo", "ё"}, {"ye", "е"}, {"x", "кс"},
+	{"a", "а"}, {"b", "б"}, {"v", "в"}, {"w", "в"}, {"g", "г"}, {"d", "д"}, {"e", "е"}, {"z", "з"},
+	{"i", "и"}, {"y", "й"}, {"k", "к"}, {"c", "к"}, {"q", "к"}, {"l", "л"}, {"m", "м"}, {"n", "н"},
+	{"o", "о"}, {"p", "п"}, {"r", "р"}, {"s", "с"}, {"t", "т"}, {"u", "у"}, {"f", "ф"}, {"h", "х"},
+	{"j", "дж"},
+}
+
+// transliterate converts Cyrillic text to Latin and Latin text to Cyrillic, leaving other runes as is.
+func transliterate(s string) string {
+	s = strings.ToLower(s)
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		if r >= 0x80 {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if lat, ok := cyrToLat[r]; ok {
+				b.WriteString(lat)
+			} else {
+				b.WriteRune(r)
+			}
+			i += size
+			continue
+		}
+		matched := false
+		for _, p := range latToCyr {
+			if strings.HasPrefix(s[i:], p.lat) {
+				b.WriteString(p.cyr)
+				i += len(p.lat)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// searchTerms returns the query itself plus its transliteration when the two differ.
+func searchTerms(q string) []string {
+	q = strings.TrimSpace(q)
+	if q == "" { return nil }
+	terms := []string{q}
+	if t := transliterate(q); t != strings.ToLower(q) { terms = append(terms, t) }
+	return terms
+}
+
+// SuggestServiceNames returns distinct service names for autocomplete, matching prefix first
+// and falling back to trigram similarity in either alphabet.
+func (s *SubscriptionService) SuggestServiceNames(ctx context.Context, prefix string, limit int) (_ []repository.ServiceNameSuggestion, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.SuggestServiceNames")
+	defer func() { tracing.End(span, err) }()
+	var v Validator
+	if v.Required("prefix", strings.TrimSpace(prefix)) { v.Search("prefix", prefix) }
+	v.Check(limit > 0 && limit <= MaxSuggestLimit, "limit", CodeOutOfRange, fmt.Sprintf("limit must be between 1 and %d", MaxSuggestLimit))
+	if err := v.Err(); err != nil { return nil, err }
+	return s.repo.SuggestServiceNames(ctx, strings.TrimSpace(prefix), searchTerms(prefix), limit)
+}
@@ -3,138 +3,433 @@ package service
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+	"subscription-service/internal/logger"
 	"subscription-service/internal/models"
 	"subscription-service/internal/repository"
+	"subscription-service/internal/tracing"
 )
 
+var tracer = otel.Tracer("subscription-service/service")
+
 type SubscriptionService struct {
 	repo *repository.SubscriptionRepository
+	opts Options
+}
+
+type Options struct {
+	// IdempotencyTTL is how long an Idempotency-Key is remembered for replays.
+	IdempotencyTTL time.Duration
+	// DeletedRetention is how long soft-deleted subscriptions stay restorable before purging.
+	DeletedRetention time.Duration
 }
 
-func NewSubscriptionService(repo *repository.SubscriptionRepository) *SubscriptionService {
-	return &SubscriptionService{repo: repo}
+func NewSubscriptionService(repo *repository.SubscriptionRepository, opts Options) *SubscriptionService {
+	return &SubscriptionService{repo: repo, opts: opts}
 }
 
+const monthYearLayout = "01-2006"
+
 func parseMonthYear(s string) (time.Time, error) {
 	var mm, yyyy int
 	_, err := fmt.Sscanf(s, "%02d-%04d", &mm, &yyyy)
-	if err != nil { return time.Time{}, fmt.Errorf("invalid month-year: %s", s) }
-	if mm < 1 || mm > 12 { return time.Time{}, fmt.Errorf("invalid month: %d", mm) }
+	if err != nil { return time.Time{}, models.Validation("invalid_month_year", fmt.Sprintf("invalid month-year: %s", s)) }
+	if mm < 1 || mm > 12 { return time.Time{}, models.Validation("invalid_month_year", fmt.Sprintf("invalid month: %d", mm)) }
 	return time.Date(yyyy, time.Month(mm), 1, 0, 0, 0, 0, time.UTC), nil
 }
 
 type CreateInput struct {
-	ServiceName string
-	Price       int
-	UserID      uuid.UUID
-	StartDate   string
-	EndDate     *string
+	ServiceName     string
+	// Price is a decimal amount in major units of Currency, e.g. "199.99".
+	Price           string
+	UserID          uuid.UUID
+	StartDate       string
+	EndDate         *string
+	// Currency is an ISO 4217 code; empty means DefaultCurrency on create and "keep" on update.
+	Currency        string
+	// BillingPeriod and BillingInterval default to monthly and 1 on create and are kept on
+	// update when empty or nil.
+	BillingPeriod   string
+	BillingInterval *int
+}
+
+// PatchInput carries the fields of a merge patch; nil means "leave unchanged".
+// EndDateSet tells an explicit end_date apart from an omitted one, so a nil EndDate with
+// EndDateSet clears the end date.
+type PatchInput struct {
+	ServiceName     *string
+	Price           *string
+	UserID          *uuid.UUID
+	StartDate       *string
+	EndDate         *string
+	EndDateSet      bool
+	Currency        *string
+	BillingPeriod   *string
+	BillingInterval *int
+}
+
+// Precondition is a parsed If-Match header. Any stands for "*"; otherwise the stored version
+// must be one of Versions. The zero value places no condition on the write.
+type Precondition struct {
+	Present  bool
+	Any      bool
+	Versions []int64
+}
+
+func (p Precondition) check(m models.Subscription) error {
+	if !p.Present || p.Any || slices.Contains(p.Versions, m.Version) { return nil }
+	return models.PreconditionFailed("version_mismatch", "subscription was modified, reload it and retry")
 }
 
 type ListQuery struct {
-	UserID      *uuid.UUID
-	ServiceName *string
-	From        *string
-	To          *string
-	Limit       int
-	Offset      int
+	UserIDs           []uuid.UUID
+	ServiceNames      []string
+	ServiceNamePrefix *string
+	From              *time.Time
+	To                *time.Time
+	PriceMin          *int
+	PriceMax          *int
+	ActiveAt          *time.Time
+	Status            string
+	HasEndDate        *bool
+	CreatedAfter      *time.Time
+	CreatedBefore     *time.Time
+	// Search is a fuzzy service name query; results are ranked by similarity and paged by offset only.
+	Search            string
+	// Deleted is one of repository.DeletedInclude or DeletedOnly; empty hides deleted rows.
+	Deleted           string
+	AsOf              *time.Time
+	Limit             int
+	Offset            int
+	Sort              []repository.SortKey
+	Cursor            *repository.Cursor
+}
+
+type ListPage struct {
+	Items      []models.Subscription
+	Total      int
+	NextCursor string
+	PrevCursor string
 }
 
 type TotalQuery struct {
-	UserID      *uuid.UUID
-	ServiceName *string
-	From        string
-	To          string
+	UserID         *uuid.UUID
+	ServiceName    *string
+	From           time.Time
+	To             time.Time
+	IncludeDeleted bool
+	AsOf           *time.Time
+	// Amortize spreads quarterly, yearly and other multi-month charges over the months they cover.
+	Amortize       bool
 }
 
-func (s *SubscriptionService) Create(req CreateInput) (models.Subscription, error) {
-	start, err := parseMonthYear(req.StartDate)
+func (s *SubscriptionService) Create(ctx context.Context, req CreateInput) (_ models.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Create")
+	defer func() { tracing.End(span, err) }()
+	in, err := validateInput(req)
 	if err != nil { return models.Subscription{}, err }
-	var endPtr *time.Time
-	if req.EndDate != nil {
-		end, err := parseMonthYear(*req.EndDate)
-		if err != nil { return models.Subscription{}, err }
-		endPtr = &end
-	}
-	m := models.Subscription{
-		ID:          uuid.New(),
-		ServiceName: req.ServiceName,
-		Price:       req.Price,
-		UserID:      req.UserID,
-		StartDate:   start,
-		EndDate:     endPtr,
-	}
-	ctx := context.Background()
-	created, err := s.repo.Create(ctx, m)
+	var created models.Subscription
+	err = s.repo.InTx(ctx, func(tx *repository.SubscriptionRepository) error {
+		created, err = createTx(ctx, tx, newSubscription(req, in))
+		return err
+	})
 	if err != nil { return models.Subscription{}, err }
+	logger.FromContext(ctx).Info("subscription created", zap.Stringer("subscription_id", created.ID))
 	return created, nil
 }
 
-func (s *SubscriptionService) GetByID(id uuid.UUID) (models.Subscription, error) {
-	ctx := context.Background()
+func createTx(ctx context.Context, tx *repository.SubscriptionRepository, m models.Subscription) (models.Subscription, error) {
+	created, err := tx.Create(ctx, m)
+	if err != nil { return created, err }
+	return created, recordEvent(ctx, tx, repository.EventCreated, nil, &created)
+}
+
+func (s *SubscriptionService) GetByID(ctx context.Context, id uuid.UUID) (_ models.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.GetByID")
+	defer func() { tracing.End(span, err) }()
 	return s.repo.GetByID(ctx, id)
 }
 
-func (s *SubscriptionService) Update(id uuid.UUID, req CreateInput) (models.Subscription, error) {
-	start, err := parseMonthYear(req.StartDate)
-	if err != nil { return models.Subscription{}, err }
-	var endPtr *time.Time
-	if req.EndDate != nil {
-		end, err := parseMonthYear(*req.EndDate)
-		if err != nil { return models.Subscription{}, err }
-		endPtr = &end
-	}
-	ctx := context.Background()
-	existing, err := s.repo.GetByID(ctx, id)
+// GetAsOf returns the subscription as the service stored it at asOf, for reproducing past reports.
+func (s *SubscriptionService) GetAsOf(ctx context.Context, id uuid.UUID, asOf time.Time) (_ models.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.GetAsOf")
+	defer func() { tracing.End(span, err) }()
+	return s.repo.GetAsOf(ctx, id, asOf)
+}
+
+func (s *SubscriptionService) Update(ctx context.Context, id uuid.UUID, req CreateInput, pre Precondition) (_ models.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Update")
+	defer func() { tracing.End(span, err) }()
+	updated, err := s.update(ctx, id, pre, func(existing models.Subscription) (models.Subscription, error) {
+		// The price is read in the currency it will be charged in, which is kept when omitted.
+		if req.Currency == "" { req.Currency = existing.Price.Currency }
+		in, err := validateInput(req)
+		if err != nil { return existing, err }
+		return applyInput(existing, req, in), nil
+	})
 	if err != nil { return models.Subscription{}, err }
-	existing.ServiceName = req.ServiceName
-	existing.Price = req.Price
-	existing.UserID = req.UserID
-	existing.StartDate = start
-	existing.EndDate = endPtr
-	updated, err := s.repo.Update(ctx, existing)
+	logger.FromContext(ctx).Info("subscription updated", zap.Stringer("subscription_id", id))
+	return updated, nil
+}
+
+// update runs a read-modify-write of one subscription in a transaction and records the change.
+func (s *SubscriptionService) update(ctx context.Context, id uuid.UUID, pre Precondition, change func(models.Subscription) (models.Subscription, error)) (models.Subscription, error) {
+	var updated models.Subscription
+	err := s.repo.InTx(ctx, func(tx *repository.SubscriptionRepository) error {
+		existing, err := tx.GetByID(ctx, id)
+		if err != nil { return err }
+		if err := pre.check(existing); err != nil { return err }
+		next, err := change(existing)
+		if err != nil { return err }
+		if err := checkTimelineEdit(ctx, tx, existing, next); err != nil { return err }
+		if updated, err = tx.Update(ctx, next); err != nil { return err }
+		return recordEvent(ctx, tx, repository.EventUpdated, &existing, &updated)
+	})
+	return updated, err
+}
+
+// Patch applies a merge patch on top of the stored subscription and validates the result
+// exactly like Create does.
+func (s *SubscriptionService) Patch(ctx context.Context, id uuid.UUID, p PatchInput, pre Precondition) (_ models.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Patch")
+	defer func() { tracing.End(span, err) }()
+	updated, err := s.update(ctx, id, pre, func(existing models.Subscription) (models.Subscription, error) {
+		req := inputOf(existing)
+		if p.ServiceName != nil { req.ServiceName = *p.ServiceName }
+		if p.Price != nil { req.Price = *p.Price }
+		if p.UserID != nil { req.UserID = *p.UserID }
+		if p.StartDate != nil { req.StartDate = *p.StartDate }
+		if p.EndDateSet { req.EndDate = p.EndDate }
+		if p.Currency != nil { req.Currency = *p.Currency }
+		if p.BillingPeriod != nil { req.BillingPeriod = *p.BillingPeriod }
+		if p.BillingInterval != nil { req.BillingInterval = p.BillingInterval }
+		in, err := validateInput(req)
+		if err != nil { return existing, err }
+		return applyInput(existing, req, in), nil
+	})
 	if err != nil { return models.Subscription{}, err }
+	logger.FromContext(ctx).Info("subscription patched", zap.Stringer("subscription_id", id))
 	return updated, nil
 }
 
-func (s *SubscriptionService) Delete(id uuid.UUID) error {
-	ctx := context.Background()
-	return s.repo.Delete(ctx, id)
-}
-
-func (s *SubscriptionService) List(q ListQuery) ([]models.Subscription, int, error) {
-	ctx := context.Background()
-	var from, to *time.Time
-	if q.From != nil { t, err := parseMonthYear(*q.From); if err != nil { return nil, 0, err }; from = &t }
-	if q.To != nil { t, err := parseMonthYear(*q.To); if err != nil { return nil, 0, err }; to = &t }
-	return s.repo.List(ctx, repository.ListFilters{UserID: q.UserID, ServiceName: q.ServiceName, From: from, To: to, Limit: q.Limit, Offset: q.Offset})
-}
-
-func monthsBetweenInclusive(a, b time.Time) int {
-	return (int(b.Year())-int(a.Year()))*12 + int(b.Month()) - int(a.Month()) + 1
-}
-
-func (s *SubscriptionService) Total(q TotalQuery) (int, error) {
-	ctx := context.Background()
-	from, err := parseMonthYear(q.From)
-	if err != nil { return 0, err }
-	to, err := parseMonthYear(q.To)
-	if err != nil { return 0, err }
-	items, _, err := s.repo.List(ctx, repository.ListFilters{UserID: q.UserID, ServiceName: q.ServiceName, From: &from, To: &to, Limit: 100000, Offset: 0})
-	if err != nil { return 0, err }
-	var sum int
-	for _, sbs := range items {
-		start := sbs.StartDate
-		end := to
-		if sbs.EndDate != nil && sbs.EndDate.Before(to) { end = *sbs.EndDate }
-		if end.Before(from) || start.After(to) { continue }
-		if start.Before(from) { start = from }
-		months := monthsBetweenInclusive(start, end)
-		if months < 0 { months = 0 }
-		sum += sbs.Price * months
+func newSubscription(req CreateInput, in validInput) models.Subscription {
+	return applyInput(models.Subscription{ID: uuid.New(), BillingPeriod: models.BillingMonthly, BillingInterval: 1}, req, in)
+}
+
+func inputOf(m models.Subscription) CreateInput {
+	in := CreateInput{ServiceName: m.ServiceName, Price: m.Price.String(), UserID: m.UserID, StartDate: m.StartDate.Format(monthYearLayout), Currency: m.Price.Currency,
+		BillingPeriod: m.BillingPeriod, BillingInterval: &m.BillingInterval}
+	if m.EndDate != nil {
+		end := m.EndDate.Format(monthYearLayout)
+		in.EndDate = &end
 	}
-	return sum, nil
+	return in
+}
+
+func applyInput(m models.Subscription, req CreateInput, in validInput) models.Subscription {
+	m.ServiceName = req.ServiceName
+	m.Price = in.price
+	m.UserID = req.UserID
+	m.StartDate = in.start
+	m.EndDate = in.end
+	if req.BillingPeriod != "" { m.BillingPeriod = req.BillingPeriod }
+	if req.BillingInterval != nil { m.BillingInterval = *req.BillingInterval }
+	return m
+}
+
+func (s *SubscriptionService) Delete(ctx context.Context, id uuid.UUID, pre Precondition) (err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Delete")
+	defer func() { tracing.End(span, err) }()
+	err = s.repo.InTx(ctx, func(tx *repository.SubscriptionRepository) error {
+		existing, err := tx.GetByID(ctx, id)
+		if err != nil { return err }
+		if err := pre.check(existing); err != nil { return err }
+		deleted, err := tx.Delete(ctx, id, &existing.Version)
+		if err != nil { return err }
+		return recordEvent(ctx, tx, repository.EventDeleted, &existing, &deleted)
+	})
+	if err != nil { return err }
+	logger.FromContext(ctx).Info("subscription deleted", zap.Stringer("subscription_id", id))
+	return nil
+}
+
+// Restore brings back a soft-deleted subscription; restoring a live one is a conflict.
+func (s *SubscriptionService) Restore(ctx context.Context, id uuid.UUID, pre Precondition) (_ models.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Restore")
+	defer func() { tracing.End(span, err) }()
+	var restored models.Subscription
+	err = s.repo.InTx(ctx, func(tx *repository.SubscriptionRepository) error {
+		deleted, err := tx.GetIncludingDeleted(ctx, id)
+		if err != nil { return err }
+		if deleted.DeletedAt == nil { return models.Conflict("subscription_not_deleted", "subscription is not deleted", nil) }
+		if err := pre.check(deleted); err != nil { return err }
+		if restored, err = tx.Restore(ctx, id, &deleted.Version); err != nil { return err }
+		return recordEvent(ctx, tx, repository.EventRestored, &deleted, &restored)
+	})
+	if err != nil { return models.Subscription{}, err }
+	logger.FromContext(ctx).Info("subscription restored", zap.Stringer("subscription_id", id))
+	return restored, nil
+}
+
+// PurgeDeleted hard-deletes subscriptions soft-deleted longer than the retention period.
+func (s *SubscriptionService) PurgeDeleted(ctx context.Context) (int64, error) {
+	return s.repo.PurgeDeleted(ctx, s.opts.DeletedRetention)
+}
+
+func (s *SubscriptionService) List(ctx context.Context, q ListQuery) (_ ListPage, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.List")
+	defer func() { tracing.End(span, err) }()
+	var v Validator
+	v.ListQuery(q)
+	if err := v.Err(); err != nil { return ListPage{}, err }
+	if len(q.Sort) == 0 { q.Sort = repository.DefaultSort }
+	res, err := s.repo.List(ctx, repository.ListFilters{
+		UserIDs:           q.UserIDs,
+		ServiceNames:      q.ServiceNames,
+		ServiceNamePrefix: q.ServiceNamePrefix,
+		From:              q.From,
+		To:                q.To,
+		PriceMin:          q.PriceMin,
+		PriceMax:          q.PriceMax,
+		ActiveAt:          q.ActiveAt,
+		Status:            q.Status,
+		HasEndDate:        q.HasEndDate,
+		CreatedAfter:      q.CreatedAfter,
+		CreatedBefore:     q.CreatedBefore,
+		SearchTerms:       searchTerms(q.Search),
+		Deleted:           q.Deleted,
+		AsOf:              q.AsOf,
+		Limit:             q.Limit,
+		Offset:            q.Offset,
+		Sort:              q.Sort,
+		After:             q.Cursor,
+	})
+	if err != nil { return ListPage{}, err }
+
+	page := ListPage{Items: res.Items, Total: res.Total}
+	if len(res.Items) == 0 || q.Search != "" { return page, nil }
+	backward := q.Cursor != nil && q.Cursor.Backward
+	hasNext := backward || res.HasMore
+	hasPrev := (backward && res.HasMore) || (!backward && (q.Cursor != nil || q.Offset > 0))
+	if hasNext { page.NextCursor = EncodeCursor(q.Sort, repository.CursorAt(q.Sort, res.Items[len(res.Items)-1], false)) }
+	if hasPrev { page.PrevCursor = EncodeCursor(q.Sort, repository.CursorAt(q.Sort, res.Items[0], true)) }
+	return page, nil
+}
+
+func totalFilters(q TotalQuery) (repository.TotalFilters, error) {
+	var v Validator
+	v.Range("from", &q.From, &q.To, "to")
+	if err := v.Err(); err != nil { return repository.TotalFilters{}, err }
+	return repository.TotalFilters{UserID: q.UserID, ServiceName: q.ServiceName, From: q.From, To: q.To, IncludeDeleted: q.IncludeDeleted, AsOf: q.AsOf, Amortize: q.Amortize}, nil
+}
+
+// singleCurrency returns the currency all amounts are in, ignoring amounts without one. Charges
+// in several currencies are only added up converted, by TotalIn, so they require a currency.
+func singleCurrency(amounts []models.Money) (string, error) {
+	var currencies []string
+	for _, m := range amounts {
+		if m.Currency != "" && !slices.Contains(currencies, m.Currency) { currencies = append(currencies, m.Currency) }
+	}
+	if len(currencies) > 1 {
+		slices.Sort(currencies)
+		var v Validator
+		v.Add("currency", CodeRequired, fmt.Sprintf("currency is required to add up subscriptions in %s", strings.Join(currencies, ", ")))
+		return "", v.Err()
+	}
+	if len(currencies) == 0 { return "", nil }
+	return currencies[0], nil
+}
+
+// Total adds up the charges in the window without converting them, so they must all be in one
+// currency; use TotalIn otherwise. Without matching subscriptions the total has no currency.
+func (s *SubscriptionService) Total(ctx context.Context, q TotalQuery) (_ models.Money, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Total")
+	defer func() { tracing.End(span, err) }()
+	f, err := totalFilters(q)
+	if err != nil { return models.Money{}, err }
+	sums, err := s.repo.SumOverlapMonths(ctx, f)
+	if err != nil { return models.Money{}, err }
+	if _, err := singleCurrency(sums); err != nil { return models.Money{}, err }
+	if len(sums) == 0 { return models.Money{}, nil }
+	return sums[0], nil
+}
+
+// Explain returns the total together with every subscription term it is made of.
+func (s *SubscriptionService) Explain(ctx context.Context, q TotalQuery) (_ models.Money, _ []repository.Contribution, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Explain")
+	defer func() { tracing.End(span, err) }()
+	f, err := totalFilters(q)
+	if err != nil { return models.Money{}, nil, err }
+	items, err := s.repo.OverlapContributions(ctx, f)
+	if err != nil { return models.Money{}, nil, err }
+	amounts := make([]models.Money, 0, len(items))
+	for _, c := range items { amounts = append(amounts, c.Amount) }
+	currency, err := singleCurrency(amounts)
+	if err != nil { return models.Money{}, nil, err }
+	sum := models.Money{Currency: currency}
+	for _, c := range items {
+		if sum, err = sum.Add(c.Amount); err != nil { return models.Money{}, nil, err }
+	}
+	return sum, items, nil
+}
+
+// BreakdownResult holds one bucket per key and currency, and the bucket amounts added up per
+// currency, ordered by currency.
+type BreakdownResult struct {
+	Buckets []repository.Bucket
+	Totals  []models.Money
+}
+
+// Breakdown splits the charges of Total into buckets. Unlike Total it does not require a single
+// currency: a key charged in several currencies has a bucket for each.
+func (s *SubscriptionService) Breakdown(ctx context.Context, q TotalQuery, groupBy string) (_ BreakdownResult, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Breakdown")
+	defer func() { tracing.End(span, err) }()
+	switch groupBy {
+	case repository.GroupByMonth, repository.GroupByServiceName, repository.GroupByUserID:
+	default:
+		var v Validator
+		v.Add("group_by", CodeInvalidValue, "group_by must be one of month, service_name, user_id")
+		return BreakdownResult{}, v.Err()
+	}
+	f, err := totalFilters(q)
+	if err != nil { return BreakdownResult{}, err }
+	buckets, err := s.repo.SumOverlapMonthsGrouped(ctx, f, groupBy)
+	if err != nil { return BreakdownResult{}, err }
+	currencies := currenciesOf(buckets)
+	res := BreakdownResult{Buckets: buckets, Totals: make([]models.Money, len(currencies))}
+	for i, c := range currencies { res.Totals[i].Currency = c }
+	for i, b := range buckets {
+		// Empty months come without a currency; with a single one they are zero in it.
+		if b.Amount.Currency == "" {
+			if len(currencies) == 1 { buckets[i].Amount.Currency = currencies[0] }
+			continue
+		}
+		t := &res.Totals[slices.Index(currencies, b.Amount.Currency)]
+		if *t, err = t.Add(b.Amount); err != nil { return BreakdownResult{}, err }
+	}
+	return res, nil
+}
+
+func currenciesOf(buckets []repository.Bucket) []string {
+	var currencies []string
+	for _, b := range buckets {
+		if b.Amount.Currency != "" && !slices.Contains(currencies, b.Amount.Currency) { currencies = append(currencies, b.Amount.Currency) }
+	}
+	slices.Sort(currencies)
+	return currencies
+}
+
+// MonthlySpend returns what every service charges in month, with longer billing cycles
+// amortized, as one bucket per service name and currency; it feeds the business metrics.
+func (s *SubscriptionService) MonthlySpend(ctx context.Context, month time.Time) (_ []repository.Bucket, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.MonthlySpend")
+	defer func() { tracing.End(span, err) }()
+	return s.repo.SumOverlapMonthsGrouped(ctx, repository.TotalFilters{From: month, To: month, Amortize: true}, repository.GroupByServiceName)
 }
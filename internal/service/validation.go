@@ -0,0 +1,261 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+)
+
+const (
+	CodeRequired      = "required"
+	CodeInvalidFormat = "invalid_format"
+	CodeOutOfRange    = "out_of_range"
+	CodeTooLong       = "too_long"
+	CodeInvalidValue  = "invalid_value"
+	CodeInvalidRange  = "invalid_range"
+	CodeUnknownField  = "unknown_field"
+
+	MaxServiceNameLength = 255
+	MaxListLimit         = 1000
+	MaxBillingInterval   = 52
+
+	// DefaultCurrency is what subscriptions created without a currency are billed in.
+	DefaultCurrency = "RUB"
+)
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Validator collects field problems so that a request reports all of them at once.
+type Validator struct {
+	fields []models.FieldError
+}
+
+func (v *Validator) Add(field, code, message string) {
+	v.fields = append(v.fields, models.FieldError{Field: field, Code: code, Message: message})
+}
+
+func (v *Validator) Check(ok bool, field, code, message string) {
+	if !ok { v.Add(field, code, message) }
+}
+
+func (v *Validator) Required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Add(field, CodeRequired, field+" is required")
+		return false
+	}
+	return true
+}
+
+func (v *Validator) MonthYear(field, value string) (time.Time, bool) {
+	t, err := parseMonthYear(value)
+	if err != nil {
+		v.Add(field, CodeInvalidFormat, field+" must be in MM-YYYY format")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (v *Validator) UUID(field, value string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		v.Add(field, CodeInvalidFormat, field+" must be a valid UUID")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func (v *Validator) Int(field, value string, min, max int) (int, bool) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		v.Add(field, CodeInvalidFormat, field+" must be an integer")
+		return 0, false
+	}
+	if n < min || n > max {
+		v.Add(field, CodeOutOfRange, fmt.Sprintf("%s must be between %d and %d", field, min, max))
+		return 0, false
+	}
+	return n, true
+}
+
+func (v *Validator) Bool(field, value string) (bool, bool) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		v.Add(field, CodeInvalidFormat, field+" must be true or false")
+		return false, false
+	}
+	return b, true
+}
+
+func (v *Validator) Timestamp(field, value string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		v.Add(field, CodeInvalidFormat, field+" must be an RFC 3339 timestamp")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (v *Validator) OneOf(field, value string, allowed ...string) bool {
+	if slices.Contains(allowed, value) { return true }
+	v.Add(field, CodeInvalidValue, fmt.Sprintf("%s must be one of %s", field, strings.Join(allowed, ", ")))
+	return false
+}
+
+// Cursor decodes a pagination cursor and checks that it was issued for the same sort order.
+func (v *Validator) Cursor(field, value string, keys []repository.SortKey) (repository.Cursor, bool) {
+	sig, c, err := DecodeCursor(value)
+	switch {
+	case err != nil:
+		v.Add(field, CodeInvalidFormat, field+" is not a valid pagination cursor")
+	case sig != repository.SortSignature(keys):
+		v.Add(field, CodeInvalidValue, field+" was issued for a different sort order")
+	case len(c.Values) != len(keys) || !sortValuesValid(keys, c.Values):
+		v.Add(field, CodeInvalidFormat, field+" is not a valid pagination cursor")
+	default:
+		return c, true
+	}
+	return repository.Cursor{}, false
+}
+
+func sortValuesValid(keys []repository.SortKey, values []string) bool {
+	for i, k := range keys {
+		if !repository.IsSortValue(k.Field, values[i]) { return false }
+	}
+	return true
+}
+
+// Sort parses "field[:asc|desc],..." against the repository allow-list.
+func (v *Validator) Sort(field, value string) ([]repository.SortKey, bool) {
+	var keys []repository.SortKey
+	seen := map[string]bool{}
+	ok := true
+	for _, part := range strings.Split(value, ",") {
+		name, dir, _ := strings.Cut(strings.TrimSpace(part), ":")
+		if !repository.IsSortField(name) {
+			v.Add(field, CodeInvalidValue, fmt.Sprintf("cannot sort by %q; allowed: %s", name, strings.Join(repository.SortFields(), ", ")))
+			ok = false
+			continue
+		}
+		if seen[name] {
+			v.Add(field, CodeInvalidValue, fmt.Sprintf("%s is listed more than once", name))
+			ok = false
+			continue
+		}
+		seen[name] = true
+		switch strings.ToLower(dir) {
+		case "", "asc":
+			keys = append(keys, repository.SortKey{Field: name})
+		case "desc":
+			keys = append(keys, repository.SortKey{Field: name, Desc: true})
+		default:
+			v.Add(field, CodeInvalidValue, fmt.Sprintf("sort direction for %s must be asc or desc", name))
+			ok = false
+		}
+	}
+	return keys, ok
+}
+
+// Range checks that from is not after to; both are optional.
+func (v *Validator) Range(fromField string, from, to *time.Time, toField string) {
+	if from != nil && to != nil && from.After(*to) {
+		v.Add(toField, CodeInvalidRange, toField+" must not be before "+fromField)
+	}
+}
+
+// ListQuery checks the cross-field rules of an already parsed list query.
+func (v *Validator) ListQuery(q ListQuery) {
+	v.Range("from", q.From, q.To, "to")
+	v.Check(q.Limit > 0 && q.Limit <= MaxListLimit, "limit", CodeOutOfRange, fmt.Sprintf("limit must be between 1 and %d", MaxListLimit))
+	v.Check(q.Offset >= 0, "offset", CodeOutOfRange, "offset must not be negative")
+	v.Check(q.Cursor == nil || q.Offset == 0, "offset", CodeInvalidValue, "offset cannot be combined with cursor")
+	v.Check(q.PriceMin == nil || q.PriceMax == nil || *q.PriceMin <= *q.PriceMax, "price_max", CodeInvalidRange, "price_max must not be below price_min")
+	v.Check(q.CreatedAfter == nil || q.CreatedBefore == nil || q.CreatedAfter.Before(*q.CreatedBefore), "created_before", CodeInvalidRange, "created_before must be after created_after")
+	if q.Status != "" { v.OneOf("status", q.Status, repository.StatusActive, repository.StatusEnded) }
+	if q.Deleted != "" { v.OneOf("deleted", q.Deleted, repository.DeletedInclude, repository.DeletedOnly) }
+	if q.Search != "" {
+		v.Search("q", q.Search)
+		v.Check(q.Cursor == nil, "cursor", CodeInvalidValue, "cursor cannot be combined with q, results are ranked by relevance")
+	}
+}
+
+// Currency checks for an upper-case ISO 4217 code.
+func (v *Validator) Currency(field, value string) bool {
+	if currencyCode.MatchString(value) { return true }
+	v.Add(field, CodeInvalidFormat, fmt.Sprintf("%s must be a three-letter ISO 4217 code like RUB", field))
+	return false
+}
+
+// Money reads a decimal amount of currency in major units, such as "199.99".
+func (v *Validator) Money(field, value, currency string) (models.Money, bool) {
+	if !v.Required(field, value) { return models.Money{}, false }
+	m, err := models.ParseMoney(value, currency)
+	if err != nil {
+		code := CodeInvalidFormat
+		if errors.Is(err, models.ErrMoneyOverflow) { code = CodeOutOfRange }
+		v.Add(field, code, field+" "+err.Error())
+		return models.Money{}, false
+	}
+	return m, true
+}
+
+// Search checks a free-text search term.
+func (v *Validator) Search(field, value string) {
+	v.Check(utf8.RuneCountInString(value) <= MaxSearchLength, field, CodeTooLong,
+		fmt.Sprintf("%s must be at most %d characters", field, MaxSearchLength))
+}
+
+func (v *Validator) Err() error {
+	if len(v.fields) == 0 { return nil }
+	return models.InvalidFields(v.fields)
+}
+
+type validInput struct {
+	price models.Money
+	start time.Time
+	end   *time.Time
+}
+
+func validateInput(in CreateInput) (validInput, error) {
+	var v Validator
+	var out validInput
+	if v.Required("service_name", in.ServiceName) {
+		v.Check(utf8.RuneCountInString(in.ServiceName) <= MaxServiceNameLength, "service_name", CodeTooLong,
+			fmt.Sprintf("service_name must be at most %d characters", MaxServiceNameLength))
+	}
+	currency := in.Currency
+	if currency == "" { currency = DefaultCurrency }
+	if v.Currency("currency", currency) {
+		if price, ok := v.Money("price", in.Price, currency); ok {
+			v.Check(price.Amount >= 0, "price", CodeOutOfRange, "price must not be negative")
+			out.price = price
+		}
+	}
+	v.Check(in.UserID != uuid.Nil, "user_id", CodeRequired, "user_id is required")
+	if in.BillingPeriod != "" {
+		v.OneOf("billing_period", in.BillingPeriod, models.BillingWeekly, models.BillingMonthly, models.BillingQuarterly, models.BillingYearly)
+	}
+	if in.BillingInterval != nil {
+		v.Check(*in.BillingInterval >= 1 && *in.BillingInterval <= MaxBillingInterval, "billing_interval", CodeOutOfRange,
+			fmt.Sprintf("billing_interval must be between 1 and %d", MaxBillingInterval))
+	}
+	startOK := false
+	if v.Required("start_date", in.StartDate) {
+		out.start, startOK = v.MonthYear("start_date", in.StartDate)
+	}
+	if in.EndDate != nil {
+		if end, ok := v.MonthYear("end_date", *in.EndDate); ok {
+			out.end = &end
+			if startOK { v.Range("start_date", &out.start, out.end, "end_date") }
+		}
+	}
+	return out, v.Err()
+}
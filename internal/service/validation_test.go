@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+
+	"subscription-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+func TestValidatorCursorChecksValueTypes(t *testing.T) {
+	keys := []repository.SortKey{{Field: "price", Desc: true}, {Field: "end_date"}, {Field: "created_at"}, {Field: "service_name"}}
+	cases := []struct {
+		name   string
+		values []string
+		ok     bool
+	}{
+		{"issued by the server", []string{"19900", "2025-03-01", "2025-01-02T03:04:05.123456Z", "Yandex Plus"}, true},
+		{"open end date", []string{"0", "infinity", "2025-01-02T03:04:05Z", ""}, true},
+		{"price not a number", []string{"19.9", "2025-03-01", "2025-01-02T03:04:05Z", "x"}, false},
+		{"price beyond int64", []string{"9223372036854775808", "2025-03-01", "2025-01-02T03:04:05Z", "x"}, false},
+		{"malformed date", []string{"1", "03-2025", "2025-01-02T03:04:05Z", "x"}, false},
+		{"impossible date", []string{"1", "2025-02-30", "2025-01-02T03:04:05Z", "x"}, false},
+		{"year zero", []string{"1", "0000-01-01", "2025-01-02T03:04:05Z", "x"}, false},
+		{"malformed timestamp", []string{"1", "2025-03-01", "x", "x"}, false},
+		{"timestamp without zone", []string{"1", "2025-03-01", "2025-01-02T03:04:05", "x"}, false},
+		{"NUL in text", []string{"1", "2025-03-01", "2025-01-02T03:04:05Z", "a\x00b"}, false},
+		{"too few values", []string{"1", "2025-03-01", "2025-01-02T03:04:05Z"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			token := EncodeCursor(keys, repository.Cursor{Values: tc.values, ID: uuid.New()})
+			var v Validator
+			_, ok := v.Cursor("cursor", token, keys)
+			if ok != tc.ok { t.Fatalf("Cursor ok = %v, want %v (%v)", ok, tc.ok, v.Err()) }
+			if !ok && (len(v.fields) != 1 || v.fields[0].Code != CodeInvalidFormat) { t.Fatalf("Cursor errors = %+v, want one %s", v.fields, CodeInvalidFormat) }
+		})
+	}
+}
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_subscriptions_created_at_id ON subscriptions(created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_subscriptions_created_at_id;
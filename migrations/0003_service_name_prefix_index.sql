@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_subscriptions_service_name_lower ON subscriptions(lower(service_name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_price ON subscriptions(price);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_subscriptions_price;
+DROP INDEX IF EXISTS idx_subscriptions_service_name_lower;
@@ -0,0 +1,6 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_subscriptions_service_name_trgm ON subscriptions USING gin (service_name gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_subscriptions_service_name_trgm;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS version;
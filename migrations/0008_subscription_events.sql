@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS subscription_events (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id UUID NOT NULL,
+    event_type TEXT NOT NULL CHECK (event_type IN ('created', 'updated', 'deleted', 'restored')),
+    actor TEXT NULL,
+    request_id TEXT NULL,
+    before JSONB NULL,
+    after JSONB NULL,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_events_subscription ON subscription_events(subscription_id, id DESC);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION subscription_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'subscription_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER subscription_events_no_change
+    BEFORE UPDATE OR DELETE ON subscription_events
+    FOR EACH ROW EXECUTE FUNCTION subscription_events_append_only();
+
+-- +goose Down
+DROP TABLE IF EXISTS subscription_events;
+DROP FUNCTION IF EXISTS subscription_events_append_only();
@@ -0,0 +1,48 @@
+-- +goose Up
+-- Every state a subscription row has been in, valid over system time [valid_from, valid_to).
+-- The subscription columns follow valid_from/valid_to in the same order as in subscriptions, so
+-- the trigger can copy NEW.*; a column added to subscriptions must be added here too.
+CREATE TABLE IF NOT EXISTS subscription_versions (
+    valid_from TIMESTAMPTZ NOT NULL,
+    valid_to TIMESTAMPTZ NULL,
+    id UUID NOT NULL,
+    service_name TEXT NOT NULL,
+    price INT NOT NULL,
+    user_id UUID NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    version BIGINT NOT NULL,
+    deleted_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_versions_id ON subscription_versions(id, valid_from);
+CREATE INDEX IF NOT EXISTS idx_subscription_versions_period ON subscription_versions(valid_from, valid_to);
+
+-- Earlier edits of existing rows are unknown, so their current state is assumed since creation.
+INSERT INTO subscription_versions
+SELECT created_at, NULL, s.* FROM subscriptions s;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION subscriptions_track_versions() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE subscription_versions SET valid_to = now() WHERE id = OLD.id AND valid_to IS NULL;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        INSERT INTO subscription_versions SELECT now(), NULL, NEW.*;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER subscriptions_versions
+    AFTER INSERT OR UPDATE OR DELETE ON subscriptions
+    FOR EACH ROW EXECUTE FUNCTION subscriptions_track_versions();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS subscriptions_versions ON subscriptions;
+DROP FUNCTION IF EXISTS subscriptions_track_versions();
+DROP TABLE IF EXISTS subscription_versions;
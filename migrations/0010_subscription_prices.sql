@@ -0,0 +1,14 @@
+-- +goose Up
+-- Price changes of a subscription. subscriptions.price applies from start_date until the first
+-- change; each change applies from its effective month until the next one. Changes are never
+-- edited in place, so created_at tells which of them an as-of total could already see.
+CREATE TABLE IF NOT EXISTS subscription_prices (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    effective_from DATE NOT NULL,
+    price INT NOT NULL CHECK (price >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (subscription_id, effective_from)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS subscription_prices;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB' CHECK (currency ~ '^[A-Z]{3}$');
+-- Keep subscription_versions column-compatible with subscriptions for the versioning trigger.
+ALTER TABLE subscription_versions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+-- Reference rates in the ECB convention: how many units of currency one euro buys on rate_date.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency CHAR(3) NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+    rate_date DATE NOT NULL,
+    rate NUMERIC(24, 10) NOT NULL CHECK (rate > 0),
+    PRIMARY KEY (currency, rate_date)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS exchange_rates;
+ALTER TABLE subscription_versions DROP COLUMN IF EXISTS currency;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS currency;
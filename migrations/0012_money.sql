@@ -0,0 +1,42 @@
+-- +goose Up
+-- Prices are stored in minor units (kopecks, cents) from here on, as BIGINT so that large
+-- prices fit. Most currencies have two minor digits; keep the exceptions in sync with
+-- models.Exponent.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION currency_exponent(code TEXT) RETURNS INT AS $$
+    SELECT CASE
+        WHEN code IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG',
+                      'RWF', 'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 0
+        WHEN code IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 3
+        ELSE 2
+    END
+$$ LANGUAGE sql IMMUTABLE;
+-- +goose StatementEnd
+
+ALTER TABLE subscriptions ALTER COLUMN price TYPE BIGINT
+    USING price::bigint * (10 ^ currency_exponent(currency))::bigint;
+ALTER TABLE subscription_versions ALTER COLUMN price TYPE BIGINT
+    USING price::bigint * (10 ^ currency_exponent(currency))::bigint;
+ALTER TABLE subscription_prices ALTER COLUMN price TYPE BIGINT;
+UPDATE subscription_prices p SET price = p.price * (10 ^ currency_exponent(s.currency))::bigint
+    FROM subscriptions s WHERE s.id = p.subscription_id;
+
+-- Stored idempotent responses are replayed as subscriptions, whose price now carries its currency.
+UPDATE idempotency_keys
+    SET response = jsonb_set(response - 'currency', '{price}',
+        jsonb_build_object('amount', response->>'price', 'currency', response->>'currency'))
+    WHERE jsonb_typeof(response->'price') = 'number';
+
+-- +goose Down
+UPDATE idempotency_keys
+    SET response = jsonb_set(response, '{price}', to_jsonb(trunc((response->'price'->>'amount')::numeric)::int))
+        || jsonb_build_object('currency', response->'price'->>'currency')
+    WHERE jsonb_typeof(response->'price') = 'object';
+UPDATE subscription_prices p SET price = p.price / (10 ^ currency_exponent(s.currency))::bigint
+    FROM subscriptions s WHERE s.id = p.subscription_id;
+ALTER TABLE subscription_prices ALTER COLUMN price TYPE INT;
+ALTER TABLE subscription_versions ALTER COLUMN price TYPE INT
+    USING price / (10 ^ currency_exponent(currency))::bigint;
+ALTER TABLE subscriptions ALTER COLUMN price TYPE INT
+    USING price / (10 ^ currency_exponent(currency))::bigint;
+DROP FUNCTION IF EXISTS currency_exponent(TEXT);
@@ -0,0 +1,50 @@
+-- +goose Up
+-- A subscription charges its price once every billing_interval billing periods, the first time
+-- on the first day of its start month. Weekly charges fall every 7 * billing_interval days from then.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS billing_period TEXT NOT NULL DEFAULT 'monthly'
+    CHECK (billing_period IN ('weekly', 'monthly', 'quarterly', 'yearly'));
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS billing_interval INT NOT NULL DEFAULT 1
+    CHECK (billing_interval BETWEEN 1 AND 52);
+-- Keep subscription_versions column-compatible with subscriptions for the versioning trigger.
+ALTER TABLE subscription_versions ADD COLUMN IF NOT EXISTS billing_period TEXT NOT NULL DEFAULT 'monthly';
+ALTER TABLE subscription_versions ADD COLUMN IF NOT EXISTS billing_interval INT NOT NULL DEFAULT 1;
+
+-- What a subscription charges in its first n units (days or months) when it charges price every
+-- step units, starting with the first one. Amortized, each charge is spread over the units of
+-- its cycle, rounded down cumulatively so that a whole cycle still adds up to price exactly.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION charged_through(price BIGINT, n INT, step INT, amortize BOOLEAN) RETURNS BIGINT AS $$
+    SELECT CASE WHEN amortize
+        THEN (GREATEST(n, 0) / step) * price + price * (GREATEST(n, 0) % step) / step
+        ELSE price * ((GREATEST(n, 0) + step - 1) / step)
+    END
+$$ LANGUAGE sql IMMUTABLE;
+-- +goose StatementEnd
+
+-- What a subscription billed from anchor (the first of its start month) charges in the months
+-- [lo, hi], both given as first days of month. Weekly charges happen within the month they fall
+-- in and are never amortized.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION charged_between(price BIGINT, anchor DATE, period TEXT, every INT, lo DATE, hi DATE, amortize BOOLEAN) RETURNS BIGINT AS $$
+    SELECT GREATEST(CASE period
+        WHEN 'weekly' THEN
+            charged_through(price, (hi + interval '1 month')::date - anchor, 7 * every, false)
+            - charged_through(price, lo - anchor, 7 * every, false)
+        ELSE
+            charged_through(price, (EXTRACT(YEAR FROM hi)::int - EXTRACT(YEAR FROM anchor)::int) * 12
+                + EXTRACT(MONTH FROM hi)::int - EXTRACT(MONTH FROM anchor)::int + 1,
+                every * CASE period WHEN 'quarterly' THEN 3 WHEN 'yearly' THEN 12 ELSE 1 END, amortize)
+            - charged_through(price, (EXTRACT(YEAR FROM lo)::int - EXTRACT(YEAR FROM anchor)::int) * 12
+                + EXTRACT(MONTH FROM lo)::int - EXTRACT(MONTH FROM anchor)::int,
+                every * CASE period WHEN 'quarterly' THEN 3 WHEN 'yearly' THEN 12 ELSE 1 END, amortize)
+    END, 0)
+$$ LANGUAGE sql IMMUTABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION IF EXISTS charged_between(BIGINT, DATE, TEXT, INT, DATE, DATE, BOOLEAN);
+DROP FUNCTION IF EXISTS charged_through(BIGINT, INT, INT, BOOLEAN);
+ALTER TABLE subscription_versions DROP COLUMN IF EXISTS billing_interval;
+ALTER TABLE subscription_versions DROP COLUMN IF EXISTS billing_period;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS billing_interval;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS billing_period;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE subscription_events DROP CONSTRAINT IF EXISTS subscription_events_event_type_check;
+ALTER TABLE subscription_events ADD CONSTRAINT subscription_events_event_type_check
+    CHECK (event_type IN ('created', 'updated', 'deleted', 'restored', 'price_changed'));
+
+-- +goose Down
+ALTER TABLE subscription_events DROP CONSTRAINT IF EXISTS subscription_events_event_type_check;
+ALTER TABLE subscription_events ADD CONSTRAINT subscription_events_event_type_check
+    CHECK (event_type IN ('created', 'updated', 'deleted', 'restored')) NOT VALID;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Price changes are history like subscription_versions: as-of totals still need them after the
+-- purge job hard-deletes a subscription, so they no longer cascade with it.
+ALTER TABLE subscription_prices DROP CONSTRAINT IF EXISTS subscription_prices_subscription_id_fkey;
+
+-- +goose Down
+ALTER TABLE subscription_prices ADD CONSTRAINT subscription_prices_subscription_id_fkey
+    FOREIGN KEY (subscription_id) REFERENCES subscriptions(id) ON DELETE CASCADE NOT VALID;
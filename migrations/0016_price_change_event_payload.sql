@@ -0,0 +1,7 @@
+-- +goose Up
+-- price_changed events carry the change itself: its effective month and the new price with its
+-- currency, which the subscription snapshots before and after it do not show.
+ALTER TABLE subscription_events ADD COLUMN IF NOT EXISTS price_change JSONB NULL;
+
+-- +goose Down
+ALTER TABLE subscription_events DROP COLUMN IF EXISTS price_change;
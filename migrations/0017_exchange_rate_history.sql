@@ -0,0 +1,27 @@
+-- +goose Up
+-- Keep every load of a rate instead of replacing it, so a total converted as_of an instant uses
+-- the rates that were loaded by then and an earlier report can be reproduced.
+ALTER TABLE exchange_rates ADD COLUMN IF NOT EXISTS loaded_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE exchange_rates DROP CONSTRAINT IF EXISTS exchange_rates_pkey;
+ALTER TABLE exchange_rates ADD PRIMARY KEY (currency, rate_date, loaded_at);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION exchange_rates_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'exchange_rates is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER exchange_rates_no_change
+    BEFORE UPDATE OR DELETE ON exchange_rates
+    FOR EACH ROW EXECUTE FUNCTION exchange_rates_append_only();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS exchange_rates_no_change ON exchange_rates;
+DROP FUNCTION IF EXISTS exchange_rates_append_only();
+DELETE FROM exchange_rates er USING exchange_rates newer
+    WHERE newer.currency = er.currency AND newer.rate_date = er.rate_date AND newer.loaded_at > er.loaded_at;
+ALTER TABLE exchange_rates DROP CONSTRAINT IF EXISTS exchange_rates_pkey;
+ALTER TABLE exchange_rates DROP COLUMN IF EXISTS loaded_at;
+ALTER TABLE exchange_rates ADD PRIMARY KEY (currency, rate_date);